@@ -0,0 +1,190 @@
+package ginpow
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// adaptiveBuckets is the number of buckets the sliding window is divided into
+const adaptiveBuckets = 10
+
+// AdaptiveDifficulty raises and lowers the difficulty of issued nonces based on
+// the load observed by VerifyNonceMiddleware over a sliding window. Load is the
+// number of verified requests plus `FailureWeight` times the number of failed ones.
+// The difficulty is changed by at most `Step` once per `Window`.
+type AdaptiveDifficulty struct {
+	// Min is the floor of the difficulty.
+	//   Defaults to 0.
+	Min int
+
+	// Max is the ceiling of the difficulty. Must be at least `Min`.
+	Max int
+
+	// Step is how much the difficulty is changed per adjustment.
+	//   Defaults to 1.
+	Step int
+
+	// Window is the length of the sliding window load is measured over.
+	//   Defaults to 1 minute.
+	Window time.Duration
+
+	// RaiseAt is the load in a window at which the difficulty is raised. Required.
+	RaiseAt int
+
+	// LowerAt is the load in a window under which the difficulty is lowered.
+	//   Defaults to half of `RaiseAt`.
+	LowerAt int
+
+	// FailureWeight is how much a failed verification counts towards load.
+	//   Defaults to 1.
+	FailureWeight int
+
+	mu          sync.Mutex
+	current     int
+	buckets     [adaptiveBuckets]int
+	head        int
+	bucketStart time.Time
+	lastAdjust  time.Time
+}
+
+// validate returns an error if the config is invalid, before defaults are applied
+func (a *AdaptiveDifficulty) validate() error {
+	if a.Min < 0 || a.Max < a.Min {
+		return errors.New("pow.Adaptive.Max must be at least pow.Adaptive.Min")
+	}
+
+	if a.Step < 0 || a.Window < 0 || a.FailureWeight < 0 {
+		return errors.New("pow.Adaptive.Step, Window, and FailureWeight must be positive")
+	}
+
+	if a.RaiseAt <= 0 || a.LowerAt > a.RaiseAt {
+		return errors.New("pow.Adaptive.RaiseAt must be positive and at least pow.Adaptive.LowerAt")
+	}
+	return nil
+}
+
+// init validates the config, sets defaults, and starts at the given difficulty
+func (a *AdaptiveDifficulty) init(start int) error {
+	if err := a.validate(); err != nil {
+		return err
+	}
+
+	if a.Step == 0 {
+		a.Step = 1
+	}
+
+	if a.Window == 0 {
+		a.Window = time.Minute
+	}
+
+	if a.FailureWeight == 0 {
+		a.FailureWeight = 1
+	}
+
+	if a.LowerAt == 0 {
+		a.LowerAt = a.RaiseAt / 2
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.current = clamp(start, a.Min, a.Max)
+	a.lastAdjust = timeNow()
+	return nil
+}
+
+// Difficulty returns the current difficulty.
+func (a *AdaptiveDifficulty) Difficulty() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := timeNow()
+	a.advance(now)
+	a.adjust(now)
+	return a.current
+}
+
+// Observe records the outcome of a verification.
+func (a *AdaptiveDifficulty) Observe(verified bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := timeNow()
+	a.advance(now)
+	if verified {
+		a.buckets[a.head]++
+	} else {
+		a.buckets[a.head] += a.FailureWeight
+	}
+	a.adjust(now)
+}
+
+// Load returns the load observed over the current window.
+func (a *AdaptiveDifficulty) Load() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.advance(timeNow())
+	return a.load()
+}
+
+func (a *AdaptiveDifficulty) load() int {
+	var load int
+	for _, n := range a.buckets {
+		load += n
+	}
+	return load
+}
+
+// advance rotates out buckets that have fallen out of the window
+func (a *AdaptiveDifficulty) advance(now time.Time) {
+	width := a.Window / adaptiveBuckets
+	if a.bucketStart.IsZero() || width <= 0 {
+		a.bucketStart = now
+		return
+	}
+
+	steps := int(now.Sub(a.bucketStart) / width)
+	if steps <= 0 {
+		return
+	}
+
+	if steps >= adaptiveBuckets {
+		a.buckets = [adaptiveBuckets]int{}
+	} else {
+		for i := 0; i < steps; i++ {
+			a.head = (a.head + 1) % adaptiveBuckets
+			a.buckets[a.head] = 0
+		}
+	}
+	a.bucketStart = a.bucketStart.Add(time.Duration(steps) * width)
+}
+
+// adjust changes the difficulty if the load crossed a threshold and
+// it hasn't been changed in the last window
+func (a *AdaptiveDifficulty) adjust(now time.Time) {
+	if now.Sub(a.lastAdjust) < a.Window {
+		return
+	}
+
+	load := a.load()
+	switch {
+	case load >= a.RaiseAt && a.current < a.Max:
+		a.current = clamp(a.current+a.Step, a.Min, a.Max)
+		a.lastAdjust = now
+	case load < a.LowerAt && a.current > a.Min:
+		a.current = clamp(a.current-a.Step, a.Min, a.Max)
+		a.lastAdjust = now
+	}
+}
+
+func clamp(n, lo, hi int) int {
+	if n < lo {
+		return lo
+	}
+	if n > hi {
+		return hi
+	}
+	return n
+}
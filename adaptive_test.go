@@ -0,0 +1,190 @@
+package ginpow
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAdaptiveDifficulty(t *testing.T) {
+	t.Run("init", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			a       *AdaptiveDifficulty
+			start   int
+			want    int
+			wantErr bool
+		}{
+			{"clamps to min", &AdaptiveDifficulty{Min: 4, Max: 8, RaiseAt: 10}, 0, 4, false},
+			{"clamps to max", &AdaptiveDifficulty{Min: 4, Max: 8, RaiseAt: 10}, 20, 8, false},
+			{"max under min", &AdaptiveDifficulty{Min: 4, Max: 2, RaiseAt: 10}, 0, 0, true},
+			{"no raise threshold", &AdaptiveDifficulty{Max: 8}, 0, 0, true},
+			{"lower over raise", &AdaptiveDifficulty{Max: 8, RaiseAt: 10, LowerAt: 20}, 0, 0, true},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				err := tt.a.init(tt.start)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("init() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if err == nil && tt.a.Difficulty() != tt.want {
+					t.Errorf("Difficulty() = %v, want %v", tt.a.Difficulty(), tt.want)
+				}
+			})
+		}
+	})
+
+	t.Run("raise and lower", func(t *testing.T) {
+		now := withTimeNow(t, time.Unix(1600000000, 0))
+
+		a := &AdaptiveDifficulty{Min: 2, Max: 4, RaiseAt: 10, LowerAt: 5, FailureWeight: 2}
+		a.init(2)
+
+		*now = now.Add(30 * time.Second)
+		for i := 0; i < 5; i++ {
+			a.Observe(false)
+		}
+
+		if expect := 10; a.Load() != expect {
+			t.Errorf("failures not weighted; Got: %v, Expected: %v", a.Load(), expect)
+		}
+
+		if expect := 2; a.Difficulty() != expect {
+			t.Errorf("difficulty raised before window passed; Got: %v, Expected: %v", a.Difficulty(), expect)
+		}
+
+		*now = now.Add(30 * time.Second)
+		if expect := 3; a.Difficulty() != expect {
+			t.Errorf("difficulty not raised; Got: %v, Expected: %v", a.Difficulty(), expect)
+		}
+
+		*now = now.Add(10 * time.Second)
+		for i := 0; i < 10; i++ {
+			a.Observe(true)
+		}
+		if expect := 3; a.Difficulty() != expect {
+			t.Errorf("difficulty raised twice in one window; Got: %v, Expected: %v", a.Difficulty(), expect)
+		}
+
+		*now = now.Add(50 * time.Second)
+		if expect := 4; a.Difficulty() != expect {
+			t.Errorf("difficulty not raised; Got: %v, Expected: %v", a.Difficulty(), expect)
+		}
+
+		*now = now.Add(30 * time.Second)
+		for i := 0; i < 20; i++ {
+			a.Observe(true)
+		}
+
+		*now = now.Add(30 * time.Second)
+		if expect := 4; a.Difficulty() != expect {
+			t.Errorf("difficulty raised over max; Got: %v, Expected: %v", a.Difficulty(), expect)
+		}
+
+		*now = now.Add(2 * time.Minute)
+		if expect := 0; a.Load() != expect {
+			t.Errorf("load not rotated out of window; Got: %v, Expected: %v", a.Load(), expect)
+		}
+
+		if expect := 3; a.Difficulty() != expect {
+			t.Errorf("difficulty not lowered; Got: %v, Expected: %v", a.Difficulty(), expect)
+		}
+	})
+}
+
+func TestMiddleware_Adaptive(t *testing.T) {
+	t.Run("requires check", func(t *testing.T) {
+		_, err := New(&Middleware{
+			ExtractData: func(c *gin.Context) (string, error) { return "", nil },
+			Adaptive:    &AdaptiveDifficulty{Max: 4, RaiseAt: 10},
+		})
+
+		if err == nil {
+			t.Error("New() did not error when Adaptive is set without Check")
+		}
+	})
+
+	t.Run("requires ChallengeTTL", func(t *testing.T) {
+		_, err := New(&Middleware{
+			ExtractData: func(c *gin.Context) (string, error) { return "", nil },
+			Check:       true,
+			Adaptive:    &AdaptiveDifficulty{Max: 4, RaiseAt: 10},
+		})
+
+		if err == nil {
+			t.Error("New() did not error when Adaptive is set without ChallengeTTL")
+		}
+	})
+
+	t.Run("issued difficulty", func(t *testing.T) {
+		now := withTimeNow(t, time.Unix(1600000000, 0))
+
+		m, _ := New(&Middleware{
+			ExtractData:  func(c *gin.Context) (string, error) { return "data", nil },
+			Check:        true,
+			Difficulty:   1,
+			ChallengeTTL: 5 * time.Minute,
+			Adaptive:     &AdaptiveDifficulty{Max: 20, Step: 19, RaiseAt: 1},
+		})
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Accepted = []string{gin.MIMEJSON}
+		m.NonceHandler(c)
+
+		var j map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &j)
+
+		if expect := float64(1); j["difficulty"] != expect {
+			t.Errorf("unexpected difficulty; Got: %v, Expected: %v", j["difficulty"], expect)
+		}
+
+		// solve the nonce at the difficulty it was issued at
+		nonce := j["nonce"].(string)
+		var hash string
+		for i := 0; ; i++ {
+			data := strconv.Itoa(i)
+			sum := sha256.Sum256([]byte(data + nonce))
+			if sum[0]&0x80 == 0 {
+				hash = hex.EncodeToString(sum[:])
+				m.ExtractData = func(c *gin.Context) (string, error) { return data, nil }
+				break
+			}
+		}
+
+		// raise the difficulty after the nonce was issued
+		*now = now.Add(time.Minute)
+		m.Adaptive.Observe(false)
+
+		if expect := 20; m.Adaptive.Difficulty() != expect {
+			t.Fatalf("difficulty not raised; Got: %v, Expected: %v", m.Adaptive.Difficulty(), expect)
+		}
+
+		m.ExtractNonce = func(c *gin.Context) (string, string, error) {
+			return nonce, j["nonce_checksum"].(string), nil
+		}
+		m.ExtractHash = func(c *gin.Context) (string, error) { return hash, nil }
+
+		w = httptest.NewRecorder()
+		c, _ = gin.CreateTestContext(w)
+		m.VerifyNonceMiddleware(c)
+
+		if len(c.Errors) > 0 {
+			t.Errorf("verification failed with error: %v", c.Errors)
+		}
+
+		w = httptest.NewRecorder()
+		c, _ = gin.CreateTestContext(w)
+		m.NonceHeaderMiddleware(c)
+
+		if got := w.Result().Header.Get("X-Hash-Difficulty"); got != "20" {
+			t.Errorf("new nonces not issued at raised difficulty: %v", got)
+		}
+	})
+}
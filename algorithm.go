@@ -0,0 +1,242 @@
+package ginpow
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// HashAlgorithm is a named hash function with parameters that are advertised to
+// clients so they can compute the same hash.
+type HashAlgorithm interface {
+	// Name is the name of the algorithm, e.g. `argon2id`.
+	Name() string
+
+	// Params are the parameters of the algorithm as comma separated key=value pairs.
+	Params() string
+
+	// Sum hashes b.
+	Sum(b []byte) []byte
+}
+
+// the following caps the parameters of the memory hard algorithms so the cost of
+// verifying a hash on the server stays bounded.
+const (
+	MaxArgon2Memory  = 64 * 1024 // KiB
+	MaxArgon2Time    = 4
+	MaxArgon2Threads = 4
+	MaxScryptN       = 1 << 16
+	MaxScryptR       = 16
+	MaxScryptP       = 4
+	MaxKeyLength     = 64
+)
+
+// memoryHardSalt is the salt used by the memory hard algorithms. A fixed salt is
+// fine as the hashed data always contains a nonce.
+var memoryHardSalt = []byte("gin-pow")
+
+// SHA256 is the default hash algorithm.
+type SHA256 struct{}
+
+// Name implements HashAlgorithm.
+func (SHA256) Name() string { return "sha256" }
+
+// Params implements HashAlgorithm.
+func (SHA256) Params() string { return "" }
+
+// Sum implements HashAlgorithm.
+func (SHA256) Sum(b []byte) []byte {
+	sum := sha256.Sum256(b)
+	return sum[:]
+}
+
+// size is the length of the hash in bytes
+func (SHA256) size() int { return sha256.Size }
+
+// Argon2id is a memory hard hash algorithm.
+type Argon2id struct {
+	// Memory is the memory used in KiB.
+	//   Defaults to 16 MiB. Capped at MaxArgon2Memory.
+	Memory uint32
+
+	// Time is the number of passes over the memory.
+	//   Defaults to 1. Capped at MaxArgon2Time.
+	Time uint32
+
+	// Threads is the degree of parallelism.
+	//   Defaults to 1. Capped at MaxArgon2Threads.
+	Threads uint8
+
+	// KeyLength is the length of the hash in bytes.
+	//   Defaults to 32. Capped at MaxKeyLength.
+	KeyLength uint32
+}
+
+// Name implements HashAlgorithm.
+func (Argon2id) Name() string { return "argon2id" }
+
+// Params implements HashAlgorithm.
+func (a Argon2id) Params() string {
+	a = a.withDefaults()
+	return fmt.Sprintf("m=%d,t=%d,p=%d,l=%d", a.Memory, a.Time, a.Threads, a.KeyLength)
+}
+
+// Sum implements HashAlgorithm.
+func (a Argon2id) Sum(b []byte) []byte {
+	a = a.withDefaults()
+	return argon2.IDKey(b, memoryHardSalt, a.Time, a.Memory, a.Threads, a.KeyLength)
+}
+
+// size is the length of the hash in bytes
+func (a Argon2id) size() int { return int(a.withDefaults().KeyLength) }
+
+// Validate returns an error if a parameter exceeds its cap.
+func (a Argon2id) Validate() error {
+	a = a.withDefaults()
+	if a.Memory > MaxArgon2Memory || a.Time > MaxArgon2Time || a.Threads > MaxArgon2Threads || a.KeyLength > MaxKeyLength {
+		return fmt.Errorf("argon2id parameters %v exceed caps", a.Params())
+	}
+	return nil
+}
+
+func (a Argon2id) withDefaults() Argon2id {
+	if a.Memory == 0 {
+		a.Memory = 16 * 1024
+	}
+	if a.Time == 0 {
+		a.Time = 1
+	}
+	if a.Threads == 0 {
+		a.Threads = 1
+	}
+	if a.KeyLength == 0 {
+		a.KeyLength = 32
+	}
+	return a
+}
+
+// Scrypt is a memory hard hash algorithm.
+type Scrypt struct {
+	// N is the CPU/memory cost. Must be a power of two.
+	//   Defaults to 2^14. Capped at MaxScryptN.
+	N int
+
+	// R is the block size.
+	//   Defaults to 8. Capped at MaxScryptR.
+	R int
+
+	// P is the degree of parallelism.
+	//   Defaults to 1. Capped at MaxScryptP.
+	P int
+
+	// KeyLength is the length of the hash in bytes.
+	//   Defaults to 32. Capped at MaxKeyLength.
+	KeyLength int
+}
+
+// Name implements HashAlgorithm.
+func (Scrypt) Name() string { return "scrypt" }
+
+// Params implements HashAlgorithm.
+func (s Scrypt) Params() string {
+	s = s.withDefaults()
+	return fmt.Sprintf("n=%d,r=%d,p=%d,l=%d", s.N, s.R, s.P, s.KeyLength)
+}
+
+// Sum implements HashAlgorithm. It returns nil if the parameters are invalid.
+func (s Scrypt) Sum(b []byte) []byte {
+	s = s.withDefaults()
+	key, _ := scrypt.Key(b, memoryHardSalt, s.N, s.R, s.P, s.KeyLength)
+	return key
+}
+
+// size is the length of the hash in bytes
+func (s Scrypt) size() int { return s.withDefaults().KeyLength }
+
+// Validate returns an error if a parameter is invalid or exceeds its cap.
+func (s Scrypt) Validate() error {
+	s = s.withDefaults()
+	if s.N <= 1 || s.N&(s.N-1) != 0 || s.R <= 0 || s.P <= 0 || s.KeyLength <= 0 {
+		return fmt.Errorf("invalid scrypt parameters %v", s.Params())
+	}
+	if s.N > MaxScryptN || s.R > MaxScryptR || s.P > MaxScryptP || s.KeyLength > MaxKeyLength {
+		return fmt.Errorf("scrypt parameters %v exceed caps", s.Params())
+	}
+	return nil
+}
+
+func (s Scrypt) withDefaults() Scrypt {
+	if s.N == 0 {
+		s.N = 1 << 14
+	}
+	if s.R == 0 {
+		s.R = 8
+	}
+	if s.P == 0 {
+		s.P = 1
+	}
+	if s.KeyLength == 0 {
+		s.KeyLength = 32
+	}
+	return s
+}
+
+// ParseHashAlgorithm returns the algorithm advertised by a Middleware with the given
+// name and params. Parameters are validated against the caps.
+func ParseHashAlgorithm(name, params string) (HashAlgorithm, error) {
+	values := map[string]int{}
+	for _, pair := range strings.Split(params, ",") {
+		if pair == "" {
+			continue
+		}
+
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid hash param %q", pair)
+		}
+
+		v, err := strconv.Atoi(kv[1])
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("invalid hash param %q", pair)
+		}
+		values[kv[0]] = v
+	}
+
+	var alg HashAlgorithm
+	switch name {
+	case "", "sha256":
+		return SHA256{}, nil
+	case "argon2id":
+		if values["m"] > MaxArgon2Memory || values["t"] > MaxArgon2Time || values["p"] > MaxArgon2Threads || values["l"] > MaxKeyLength {
+			return nil, errors.New("argon2id parameters exceed caps")
+		}
+		alg = Argon2id{
+			Memory:    uint32(values["m"]),
+			Time:      uint32(values["t"]),
+			Threads:   uint8(values["p"]),
+			KeyLength: uint32(values["l"]),
+		}
+	case "scrypt":
+		alg = Scrypt{N: values["n"], R: values["r"], P: values["p"], KeyLength: values["l"]}
+	default:
+		return nil, fmt.Errorf("unknown hash algorithm %q", name)
+	}
+
+	if err := validateHashAlgorithm(alg); err != nil {
+		return nil, err
+	}
+	return alg, nil
+}
+
+// validateHashAlgorithm validates an algorithm that has a Validate method
+func validateHashAlgorithm(alg HashAlgorithm) error {
+	if v, ok := alg.(interface{ Validate() error }); ok {
+		return v.Validate()
+	}
+	return nil
+}
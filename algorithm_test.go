@@ -0,0 +1,209 @@
+package ginpow
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHashAlgorithm_Params(t *testing.T) {
+	tests := []struct {
+		name string
+		alg  HashAlgorithm
+		want string
+	}{
+		{"argon2id defaults", Argon2id{}, "m=16384,t=1,p=1,l=32"},
+		{"argon2id", Argon2id{Memory: 64, Time: 2, Threads: 2, KeyLength: 16}, "m=64,t=2,p=2,l=16"},
+		{"scrypt defaults", Scrypt{}, "n=16384,r=8,p=1,l=32"},
+		{"scrypt", Scrypt{N: 16, R: 1, P: 2, KeyLength: 16}, "n=16,r=1,p=2,l=16"},
+		{"sha256", SHA256{}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.alg.Params(); got != tt.want {
+				t.Errorf("Params(); Got: %v, Expected: %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHashAlgorithm_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		alg     HashAlgorithm
+		wantErr bool
+	}{
+		{"argon2id defaults", Argon2id{}, false},
+		{"argon2id memory over cap", Argon2id{Memory: MaxArgon2Memory + 1}, true},
+		{"argon2id time over cap", Argon2id{Time: MaxArgon2Time + 1}, true},
+		{"argon2id threads over cap", Argon2id{Threads: MaxArgon2Threads + 1}, true},
+		{"argon2id key length over cap", Argon2id{KeyLength: MaxKeyLength + 1}, true},
+		{"scrypt defaults", Scrypt{}, false},
+		{"scrypt N not a power of two", Scrypt{N: 1000}, true},
+		{"scrypt N over cap", Scrypt{N: MaxScryptN * 2}, true},
+		{"scrypt R over cap", Scrypt{R: MaxScryptR + 1}, true},
+		{"scrypt negative P", Scrypt{P: -1}, true},
+		{"sha256", SHA256{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateHashAlgorithm(tt.alg); (err != nil) != tt.wantErr {
+				t.Errorf("validateHashAlgorithm() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseHashAlgorithm(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		for _, alg := range []HashAlgorithm{SHA256{}, Argon2id{Memory: 64}, Scrypt{N: 16, R: 1}} {
+			got, err := ParseHashAlgorithm(alg.Name(), alg.Params())
+			if err != nil {
+				t.Fatalf("ParseHashAlgorithm(%v) returned error: %v", alg.Name(), err)
+			}
+
+			if !bytes.Equal(got.Sum([]byte("data")), alg.Sum([]byte("data"))) {
+				t.Errorf("ParseHashAlgorithm(%v, %v) hashes differently", alg.Name(), alg.Params())
+			}
+		}
+	})
+
+	tests := []struct {
+		name      string
+		algorithm string
+		params    string
+	}{
+		{"unknown algorithm", "md5", ""},
+		{"malformed param", "argon2id", "m"},
+		{"non numeric param", "scrypt", "n=a"},
+		{"negative param", "scrypt", "n=-16"},
+		{"argon2id over cap", "argon2id", "m=1048576,t=1,p=1,l=32"},
+		{"argon2id overflowing uint32", "argon2id", "m=4294967360"},
+		{"scrypt over cap", "scrypt", "n=1048576,r=8,p=1,l=32"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseHashAlgorithm(tt.algorithm, tt.params); err == nil {
+				t.Errorf("ParseHashAlgorithm(%q, %q) did not error", tt.algorithm, tt.params)
+			}
+		})
+	}
+}
+
+func TestMiddleware_Algorithm(t *testing.T) {
+	t.Run("can't set with Hash", func(t *testing.T) {
+		_, err := New(&Middleware{
+			ExtractData: func(c *gin.Context) (string, error) { return "", nil },
+			Hash:        func(b []byte) []byte { return b },
+			Algorithm:   Argon2id{},
+		})
+
+		if err == nil {
+			t.Error("New() did not error when Hash and Algorithm are both set")
+		}
+	})
+
+	t.Run("rejects params over caps", func(t *testing.T) {
+		_, err := New(&Middleware{
+			ExtractData: func(c *gin.Context) (string, error) { return "", nil },
+			Algorithm:   Scrypt{N: MaxScryptN * 2},
+		})
+
+		if err == nil {
+			t.Error("New() did not error when Algorithm exceeds caps")
+		}
+	})
+
+	alg := Argon2id{Memory: 64}
+	m, _ := New(&Middleware{
+		ExtractData: func(c *gin.Context) (string, error) { return "data", nil },
+		Check:       true,
+		Algorithm:   alg,
+	})
+
+	t.Run("advertised by NonceHandler", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Accepted = []string{gin.MIMEJSON}
+		m.NonceHandler(c)
+
+		var j map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &j)
+
+		if j["algorithm"] != "argon2id" {
+			t.Errorf("algorithm; Got: %v, Expected: argon2id", j["algorithm"])
+		}
+
+		if j["algorithm_params"] != alg.Params() {
+			t.Errorf("algorithm_params; Got: %v, Expected: %v", j["algorithm_params"], alg.Params())
+		}
+	})
+
+	t.Run("advertised by NonceHeaderMiddleware", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		m.NonceHeaderMiddleware(c)
+
+		if got := w.Header().Get("X-Hash-Algorithm"); got != "argon2id" {
+			t.Errorf("X-Hash-Algorithm; Got: %v, Expected: argon2id", got)
+		}
+
+		if got := w.Header().Get("X-Hash-Params"); got != alg.Params() {
+			t.Errorf("X-Hash-Params; Got: %v, Expected: %v", got, alg.Params())
+		}
+	})
+
+	t.Run("not advertised without Algorithm", func(t *testing.T) {
+		m, _ := New(&Middleware{
+			ExtractData: func(c *gin.Context) (string, error) { return "data", nil },
+		})
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		m.NonceHeaderMiddleware(c)
+
+		if got := w.Header().Get("X-Hash-Algorithm"); got != "" {
+			t.Errorf("X-Hash-Algorithm; Got: %v, Expected: empty", got)
+		}
+	})
+
+	t.Run("checksum not hashed with algorithm", func(t *testing.T) {
+		nonce, nonceChecksum, _ := m.generateNonce(-1, "", "", SourceGenerateNonce)
+
+		sum := sha256.Sum256([]byte(nonce + m.Secret))
+		if expect := hex.EncodeToString(sum[:]); nonceChecksum != expect {
+			t.Errorf("nonceChecksum; Got: %v, Expected: %v", nonceChecksum, expect)
+		}
+	})
+
+	t.Run("verifies with algorithm", func(t *testing.T) {
+		nonce, nonceChecksum, _ := m.generateNonce(-1, "", "", SourceGenerateNonce)
+
+		verify := func(hash []byte) *gin.Context {
+			m.ExtractNonce = func(c *gin.Context) (string, string, error) { return nonce, nonceChecksum, nil }
+			m.ExtractHash = func(c *gin.Context) (string, error) { return hex.EncodeToString(hash), nil }
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			m.VerifyNonceMiddleware(c)
+			return c
+		}
+
+		if c := verify(alg.Sum([]byte("data" + nonce))); len(c.Errors) > 0 {
+			t.Errorf("verification failed with error: %v", c.Errors)
+		}
+
+		sum := sha256.Sum256([]byte("data" + nonce))
+		if c := verify(sum[:]); len(c.Errors) == 0 {
+			t.Error("verification passed with sha256 hash")
+		}
+	})
+}
@@ -0,0 +1,144 @@
+package ginpow
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+)
+
+// ChallengeScheme is the authentication scheme of the `WWW-Authenticate` header set on
+// failed verifications when `Middleware.ChallengeOnFailure` is true, e.g.
+//
+//	WWW-Authenticate: PoW nonce="...", checksum="...", difficulty=12, alg="argon2id", params="m=16384,t=1,p=1,l=32"
+const ChallengeScheme = "PoW"
+
+// wwwAuthenticateHeader is the header a challenge is set on
+const wwwAuthenticateHeader = "WWW-Authenticate"
+
+// reasonDataKey is the key of the failure reason in the body of a failed verification with a challenge
+const reasonDataKey = "reason"
+
+// the following are the auth params of a challenge in the `WWW-Authenticate` header.
+const (
+	ChallengeParamNonce      = "nonce"
+	ChallengeParamChecksum   = "checksum"
+	ChallengeParamDifficulty = "difficulty"
+	ChallengeParamExpires    = "expires"
+	ChallengeParamAlgorithm  = "alg"
+	ChallengeParamParams     = "params"
+	ChallengeParamScope      = "scope"
+)
+
+// challengeHeader formats a nonce as a `WWW-Authenticate` challenge
+func (pow *Middleware) challengeHeader(nonce, nonceChecksum string) string {
+	ch := pow.issuedChallenge(nonce)
+
+	params := []string{ChallengeParamNonce + "=" + quote(nonce)}
+
+	if pow.Check {
+		params = append(params, ChallengeParamChecksum+"="+quote(nonceChecksum))
+	}
+
+	params = append(params, ChallengeParamDifficulty+"="+strconv.Itoa(pow.challengeDifficulty(ch)))
+
+	if pow.ChallengeTTL > 0 {
+		params = append(params, ChallengeParamExpires+"="+strconv.FormatInt(pow.expiresAt(ch).Unix(), 10))
+	}
+
+	if pow.Algorithm != nil {
+		params = append(params, ChallengeParamAlgorithm+"="+quote(pow.Algorithm.Name()))
+		params = append(params, ChallengeParamParams+"="+quote(pow.Algorithm.Params()))
+	}
+
+	if ch.hasScope {
+		params = append(params, ChallengeParamScope+"="+quote(ch.scope))
+	}
+
+	return ChallengeScheme + " " + strings.Join(params, ", ")
+}
+
+// quote formats s as a quoted-string
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// challenged reports whether a failed verification is responded to with a challenge:
+// when `ChallengeOnFailure` is set, for any failure of a proof but a malformed one
+func (pow *Middleware) challenged(err *VerificationError) bool {
+	switch err.Code {
+	case ReasonBadHex, ReasonBodyTooLarge, ReasonInvalidJSON, ReasonError:
+		return false
+	}
+	return pow.ChallengeOnFailure
+}
+
+// setChallenge issues a fresh nonce for a failed verification, sets it in the context
+// like GenerateNonceMiddleware and in the `WWW-Authenticate` header
+func (pow *Middleware) setChallenge(c *gin.Context) error {
+	nonce, nonceChecksum, err := pow.getNonce(c, SourceChallenge)
+	if err != nil {
+		return err
+	}
+
+	c.Set(pow.NonceContextKey, nonce)
+	c.Set(pow.HashDifficultyContextKey, pow.challengeDifficulty(pow.issuedChallenge(nonce)))
+	if pow.Check {
+		c.Set(pow.NonceChecksumContextKey, nonceChecksum)
+	}
+
+	c.Header(wwwAuthenticateHeader, pow.challengeHeader(nonce, nonceChecksum))
+	return nil
+}
+
+// respondChallenge responds to a failed verification with the nonce set by setChallenge
+func (pow *Middleware) respondChallenge(c *gin.Context, err *VerificationError) {
+	nonce, nonceChecksum, _ := pow.getNonce(c, SourceChallenge)
+
+	h := pow.nonceData(nonce, nonceChecksum)
+	h[reasonDataKey] = err.Error()
+
+	c.Abort()
+	c.Negotiate(pow.FailureStatusCode, gin.Negotiate{
+		Offered: []string{gin.MIMEJSON, gin.MIMEXML},
+		Data:    h,
+	})
+}
+
+// setChallenge issues a fresh nonce for a failed verification and sets it in the
+// `WWW-Authenticate` header and in the returned request's context like GenerateNonceMiddleware
+func (pow *HTTPMiddleware) setChallenge(w http.ResponseWriter, r *http.Request) (*http.Request, error) {
+	nonce, nonceChecksum, err := pow.getNonce(r, SourceChallenge)
+	if err != nil {
+		return r, err
+	}
+
+	ctx := context.WithValue(r.Context(), contextKey(pow.NonceContextKey), nonce)
+	ctx = context.WithValue(ctx, contextKey(pow.HashDifficultyContextKey), pow.challengeDifficulty(pow.issuedChallenge(nonce)))
+	if pow.Check {
+		ctx = context.WithValue(ctx, contextKey(pow.NonceChecksumContextKey), nonceChecksum)
+	}
+
+	w.Header().Set(wwwAuthenticateHeader, pow.challengeHeader(nonce, nonceChecksum))
+	return r.WithContext(ctx), nil
+}
+
+// respondChallenge responds to a failed verification with the nonce set by setChallenge
+func (pow *HTTPMiddleware) respondChallenge(w http.ResponseWriter, r *http.Request, err *VerificationError) {
+	nonce, nonceChecksum, _ := pow.getNonce(r, SourceChallenge)
+
+	h := pow.nonceData(nonce, nonceChecksum)
+	h[reasonDataKey] = err.Error()
+
+	var rd render.Render = render.JSON{Data: h}
+	if negotiateFormat(r, gin.MIMEJSON, gin.MIMEXML) == gin.MIMEXML {
+		rd = render.XML{Data: h}
+	}
+
+	rd.WriteContentType(w)
+	w.WriteHeader(pow.FailureStatusCode)
+	rd.Render(w)
+}
@@ -0,0 +1,155 @@
+package ginpow
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMiddleware_challengeHeader(t *testing.T) {
+	now := withTimeNow(t, time.Unix(1600000000, 0))
+
+	m, _ := New(&Middleware{
+		ExtractData:  func(c *gin.Context) (string, error) { return "", nil },
+		Check:        true,
+		Difficulty:   12,
+		ChallengeTTL: time.Minute,
+		Algorithm:    Scrypt{N: 16, R: 1},
+	})
+
+	nonce, nonceChecksum, _ := m.generateNonce(-1, "", "", SourceChallenge)
+
+	expect := `PoW nonce="` + nonce + `", checksum="` + nonceChecksum + `", difficulty=12, expires=` +
+		strconv.FormatInt(now.Add(time.Minute).Unix(), 10) + `, alg="scrypt", params="n=16,r=1,p=1,l=32"`
+	if got := m.challengeHeader(nonce, nonceChecksum); got != expect {
+		t.Errorf("challengeHeader(); Got: %v, Expected: %v", got, expect)
+	}
+
+	if got := quote(`a"b\c`); got != `"a\"b\\c"` {
+		t.Errorf("quote(); Got: %v", got)
+	}
+}
+
+func TestMiddleware_ChallengeOnFailure(t *testing.T) {
+	m, _ := New(&Middleware{
+		ExtractData:        func(c *gin.Context) (string, error) { return "data", nil },
+		Check:              true,
+		Difficulty:         8,
+		ChallengeOnFailure: true,
+	})
+
+	r := gin.New()
+	r.GET("/", m.VerifyNonceMiddleware, func(c *gin.Context) { c.Status(200) })
+
+	t.Run("missing proof", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept", gin.MIMEJSON)
+		r.ServeHTTP(w, req)
+
+		if w.Code != 428 {
+			t.Errorf("missing proof returned %v, expected 428", w.Code)
+		}
+
+		if h := w.Header().Get("WWW-Authenticate"); !strings.HasPrefix(h, "PoW nonce=") {
+			t.Errorf("unexpected WWW-Authenticate header: %v", h)
+		}
+
+		var j map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &j)
+
+		if j["nonce"] == nil || j["nonce_checksum"] == nil || j["difficulty"] != float64(8) {
+			t.Errorf("body has no challenge: %v", j)
+		}
+
+		if j["reason"] != "no nonce in request" {
+			t.Errorf("reason; Got: %v, Expected: no nonce in request", j["reason"])
+		}
+
+		if !strings.Contains(w.Header().Get("WWW-Authenticate"), j["nonce"].(string)) {
+			t.Error("header and body have different nonces")
+		}
+	})
+
+	t.Run("failed proof", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Nonce", "nonce")
+		req.Header.Set("X-Nonce-Checksum", "00")
+		req.Header.Set("X-Hash", "00")
+		r.ServeHTTP(w, req)
+
+		if w.Code != 428 {
+			t.Errorf("failed proof returned %v, expected 428", w.Code)
+		}
+
+		if h := w.Header().Get("WWW-Authenticate"); !strings.HasPrefix(h, "PoW nonce=") {
+			t.Errorf("unexpected WWW-Authenticate header: %v", h)
+		}
+	})
+
+	t.Run("malformed proof", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Nonce", "nonce")
+		req.Header.Set("X-Nonce-Checksum", "00")
+		req.Header.Set("X-Hash", "not hex")
+		r.ServeHTTP(w, req)
+
+		if w.Code != 400 {
+			t.Errorf("malformed proof returned %v, expected 400", w.Code)
+		}
+	})
+
+	t.Run("custom OnFailedVerification", func(t *testing.T) {
+		var nonce interface{}
+		m, _ := New(&Middleware{
+			ExtractData:        func(c *gin.Context) (string, error) { return "data", nil },
+			ChallengeOnFailure: true,
+			OnFailedVerification: func(c *gin.Context, err *VerificationError) {
+				nonce, _ = c.Get("nonce")
+				c.AbortWithStatus(403)
+			},
+		})
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/", nil)
+		m.VerifyNonceMiddleware(c)
+
+		if w.Code != 403 || nonce == nil {
+			t.Errorf("custom handler not called with nonce in context; code: %v, nonce: %v", w.Code, nonce)
+		}
+
+		if h := w.Header().Get("WWW-Authenticate"); !strings.Contains(h, nonce.(string)) {
+			t.Errorf("unexpected WWW-Authenticate header: %v", h)
+		}
+	})
+}
+
+func TestHTTPMiddleware_ChallengeOnFailure(t *testing.T) {
+	m, _ := NewHTTP(&HTTPMiddleware{
+		Middleware:  &Middleware{ChallengeOnFailure: true},
+		ExtractData: func(r *http.Request) (string, error) { return "data", nil },
+	})
+
+	w := httptest.NewRecorder()
+	m.VerifyNonceMiddleware(http.NotFoundHandler()).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	if w.Code != 428 {
+		t.Errorf("missing proof returned %v, expected 428", w.Code)
+	}
+
+	var j map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &j)
+
+	if h := w.Header().Get("WWW-Authenticate"); j["nonce"] == nil || h != `PoW nonce="`+j["nonce"].(string)+`", difficulty=0` {
+		t.Errorf("unexpected challenge; header: %v, body: %v", h, j)
+	}
+}
@@ -0,0 +1,150 @@
+package ginpow
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Binding binds nonces to the client they are issued to, so that a solved nonce can't
+// be redeemed by another client. The nonce checksum covers the bound values of the
+// issuing request and is recomputed from the presenting request, so `Check` must be true.
+type Binding struct {
+	// ClientIP binds nonces to the IP of the client. See `TrustedProxies`.
+	//   Defaults to false.
+	ClientIP bool
+
+	// Headers binds nonces to the values of request headers, e.g. `User-Agent`.
+	//   Optional.
+	Headers []string
+
+	// TrustedProxies are the IPs or CIDRs of the proxies in front of the server, e.g. a
+	//   load balancer. The client IP of a request from a trusted proxy is read from
+	//   `ForwardedHeader`, skipping trusted proxies from the right.
+	//   Optional. If not set then the client IP is the remote address of the request.
+	TrustedProxies []string
+
+	// ForwardedHeader is the header trusted proxies set the client IP on.
+	//   Defaults to `X-Forwarded-For`
+	ForwardedHeader string
+
+	trustedNets []*net.IPNet
+}
+
+// validate returns an error if the config is invalid, before defaults are applied
+func (b *Binding) validate() error {
+	if !b.ClientIP && len(b.Headers) == 0 {
+		return errors.New("pow.Binding requires ClientIP or Headers")
+	}
+
+	_, err := parseTrustedProxies(b.TrustedProxies)
+	return err
+}
+
+func (b *Binding) init() error {
+	if err := b.validate(); err != nil {
+		return err
+	}
+
+	if b.ForwardedHeader == "" {
+		b.ForwardedHeader = "X-Forwarded-For"
+	}
+
+	b.trustedNets, _ = parseTrustedProxies(b.TrustedProxies)
+	return nil
+}
+
+// parseTrustedProxies parses trusted proxy IPs and CIDR ranges
+func parseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", proxy)
+			}
+
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", proxy)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// trusted reports whether ip is a trusted proxy
+func (b *Binding) trusted(ip net.IP) bool {
+	for _, n := range b.trustedNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the IP of the client that made a request
+func (b *Binding) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return host
+	}
+
+	if b.trusted(ip) {
+		hops := strings.Split(strings.Join(r.Header.Values(b.ForwardedHeader), ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := net.ParseIP(strings.TrimSpace(hops[i]))
+			if hop == nil {
+				break
+			}
+
+			ip = hop
+			if !b.trusted(hop) {
+				break
+			}
+		}
+	}
+
+	return ip.String()
+}
+
+// key returns a digest of the bound values of a request
+func (b *Binding) key(r *http.Request) string {
+	h := sha256.New()
+
+	if b.ClientIP {
+		fmt.Fprintf(h, "ip:%s\n", b.clientIP(r))
+	}
+
+	for _, header := range b.Headers {
+		fmt.Fprintf(h, "%s:%q\n", http.CanonicalHeaderKey(header), r.Header.Values(header))
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// clientBinding is the key a nonce issued to or presented by a request is bound to,
+// or "" if `Binding` is not set
+func (pow *Middleware) clientBinding(r *http.Request) string {
+	if pow.Binding == nil || r == nil {
+		return ""
+	}
+	return pow.Binding.key(r)
+}
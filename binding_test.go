@@ -0,0 +1,159 @@
+package ginpow
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBinding_init(t *testing.T) {
+	tests := []struct {
+		name    string
+		binding Binding
+		wantErr bool
+	}{
+		{"client ip", Binding{ClientIP: true}, false},
+		{"headers", Binding{Headers: []string{"User-Agent"}}, false},
+		{"nothing bound", Binding{}, true},
+		{"trusted proxies", Binding{ClientIP: true, TrustedProxies: []string{"10.0.0.1", "192.168.0.0/16", "::1"}}, false},
+		{"invalid trusted proxy", Binding{ClientIP: true, TrustedProxies: []string{"proxy"}}, true},
+		{"invalid trusted cidr", Binding{ClientIP: true, TrustedProxies: []string{"10.0.0.0/33"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.binding.init(); (err != nil) != tt.wantErr {
+				t.Errorf("init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("requires check", func(t *testing.T) {
+		_, err := New(&Middleware{
+			ExtractData: func(c *gin.Context) (string, error) { return "", nil },
+			Binding:     &Binding{ClientIP: true},
+		})
+
+		if err == nil {
+			t.Error("New() did not error when Binding is set without Check")
+		}
+	})
+}
+
+func TestBinding_clientIP(t *testing.T) {
+	b := &Binding{ClientIP: true, TrustedProxies: []string{"10.0.0.0/8"}}
+	b.init()
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		{"direct", "1.2.3.4:1234", "", "1.2.3.4"},
+		{"untrusted remote ignores header", "1.2.3.4:1234", "5.6.7.8", "1.2.3.4"},
+		{"trusted proxy", "10.0.0.1:1234", "5.6.7.8", "5.6.7.8"},
+		{"spoofed hop before client", "10.0.0.1:1234", "9.9.9.9, 5.6.7.8", "5.6.7.8"},
+		{"chained trusted proxies", "10.0.0.1:1234", "5.6.7.8, 10.0.0.2", "5.6.7.8"},
+		{"trusted proxy without header", "10.0.0.1:1234", "", "10.0.0.1"},
+		{"malformed hop", "10.0.0.1:1234", "5.6.7.8, garbage", "10.0.0.1"},
+		{"ipv6", "[::1]:1234", "", "::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+
+			if got := b.clientIP(r); got != tt.want {
+				t.Errorf("clientIP(); Got: %v, Expected: %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddleware_Binding(t *testing.T) {
+	m, _ := New(&Middleware{
+		ExtractData: func(c *gin.Context) (string, error) { return "data", nil },
+		Check:       true,
+		Binding: &Binding{
+			ClientIP:       true,
+			Headers:        []string{"User-Agent"},
+			TrustedProxies: []string{"10.0.0.1"},
+		},
+	})
+
+	// issue gets a nonce issued through a proxy to a client
+	issue := func(clientIP, userAgent string) (string, string) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/", nil)
+		c.Request.RemoteAddr = "10.0.0.1:1234"
+		c.Request.Header.Set("X-Forwarded-For", clientIP)
+		c.Request.Header.Set("User-Agent", userAgent)
+		m.NonceHeaderMiddleware(c)
+
+		return w.Header().Get("X-Nonce"), w.Header().Get("X-Nonce-Checksum")
+	}
+
+	// verify presents a solved nonce through a proxy from a client
+	verify := func(nonce, nonceChecksum, clientIP, userAgent string) *gin.Context {
+		sum := sha256.Sum256([]byte("data" + nonce))
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/", nil)
+		c.Request.RemoteAddr = "10.0.0.1:1234"
+		c.Request.Header.Set("X-Forwarded-For", clientIP)
+		c.Request.Header.Set("User-Agent", userAgent)
+		c.Request.Header.Set("X-Nonce", nonce)
+		c.Request.Header.Set("X-Nonce-Checksum", nonceChecksum)
+		c.Request.Header.Set("X-Hash", hex.EncodeToString(sum[:]))
+		m.VerifyNonceMiddleware(c)
+		return c
+	}
+
+	t.Run("same client", func(t *testing.T) {
+		nonce, nonceChecksum := issue("1.2.3.4", "agent")
+
+		if c := verify(nonce, nonceChecksum, "1.2.3.4", "agent"); len(c.Errors) > 0 {
+			t.Errorf("verification failed with error: %v", c.Errors)
+		}
+	})
+
+	t.Run("other ip", func(t *testing.T) {
+		nonce, nonceChecksum := issue("1.2.3.4", "agent")
+
+		c := verify(nonce, nonceChecksum, "5.6.7.8", "agent")
+		if err, ok := c.Errors.Last().Err.(*VerificationError); !ok || err.Code != ReasonChecksumMismatch {
+			t.Errorf("unexpected error for other ip: %v", c.Errors)
+		}
+	})
+
+	t.Run("other user agent", func(t *testing.T) {
+		nonce, nonceChecksum := issue("1.2.3.4", "agent")
+
+		if c := verify(nonce, nonceChecksum, "1.2.3.4", "other agent"); len(c.Errors) == 0 {
+			t.Error("verification passed from other user agent")
+		}
+	})
+
+	t.Run("unbound nonce", func(t *testing.T) {
+		unbound, _ := New(&Middleware{
+			ExtractData: func(c *gin.Context) (string, error) { return "data", nil },
+			Check:       true,
+			Secret:      m.Secret,
+		})
+		nonce, nonceChecksum, _ := unbound.generateNonce(-1, "", "", SourceGenerateNonce)
+
+		if c := verify(nonce, nonceChecksum, "1.2.3.4", "agent"); len(c.Errors) == 0 {
+			t.Error("verification passed with unbound nonce")
+		}
+	})
+}
@@ -0,0 +1,70 @@
+package ginpow
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultMaxBodySize is the default `Middleware.MaxBodySize`.
+const DefaultMaxBodySize = 1 << 20
+
+// ErrBodyTooLarge is the error of a request with a body larger than `Middleware.MaxBodySize`.
+var ErrBodyTooLarge = errors.New("request body is too large")
+
+// BodyDigest returns the data a proof of a request is made against by the default
+// ExtractData: the method, path and hex encoded sha256 digest of the body, separated by
+// spaces, e.g. `POST /login 9f86d0...`. The client appends its counter to it and sends the
+// counter on the `X-Hash-Counter` header, so that a proof is bound to the exact request.
+func BodyDigest(method, path string, body []byte) string {
+	sum := sha256.Sum256(body)
+	return method + " " + path + " " + hex.EncodeToString(sum[:])
+}
+
+// readBody reads the body of a request up to maxBytes, and restores it for the next handlers,
+// including when it is too large or fails to be read, so that a request that isn't rejected
+// in `ReportOnly` mode still gets its whole body
+func readBody(r *http.Request, maxBytes int64) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBytes+1))
+	r.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(body)) > maxBytes {
+		return nil, ErrBodyTooLarge
+	}
+	return body, nil
+}
+
+// digestRequest returns the BodyDigest of a request followed by the counter on the `HashCounterHeader` header
+func (pow *Middleware) digestRequest(r *http.Request) (string, error) {
+	body, err := readBody(r, pow.MaxBodySize)
+	if err != nil {
+		return "", err
+	}
+
+	return BodyDigest(r.Method, r.URL.Path, body) + r.Header.Get(pow.HashCounterHeader), nil
+}
+
+// ExtractBodyDigest is the default ExtractData. It returns the BodyDigest of the request
+// followed by the counter on the `HashCounterHeader` header. The body is restored so that
+// the next handlers can read it. It returns ErrBodyTooLarge for a body larger than `MaxBodySize`.
+func (pow *Middleware) ExtractBodyDigest(c *gin.Context) (string, error) {
+	return pow.digestRequest(c.Request)
+}
+
+// ExtractBodyDigest is the default ExtractData. See `Middleware.ExtractBodyDigest`.
+func (pow *HTTPMiddleware) ExtractBodyDigest(r *http.Request) (string, error) {
+	return pow.digestRequest(r)
+}
@@ -0,0 +1,137 @@
+package ginpow
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBodyDigest(t *testing.T) {
+	sum := sha256.Sum256([]byte("body"))
+	expect := "POST /login " + hex.EncodeToString(sum[:])
+
+	if got := BodyDigest("POST", "/login", []byte("body")); got != expect {
+		t.Errorf("BodyDigest(); Got: %v, Expected: %v", got, expect)
+	}
+
+	if BodyDigest("POST", "/login", nil) == BodyDigest("POST", "/logout", nil) {
+		t.Error("BodyDigest() does not depend on the path")
+	}
+}
+
+func TestMiddleware_ExtractBodyDigest(t *testing.T) {
+	m, _ := New(&Middleware{MaxBodySize: 8})
+
+	t.Run("body restored", func(t *testing.T) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("POST", "/", strings.NewReader("body"))
+
+		if _, err := m.ExtractBodyDigest(c); err != nil {
+			t.Fatalf("ExtractBodyDigest() returned error: %v", err)
+		}
+
+		if b, _ := ioutil.ReadAll(c.Request.Body); string(b) != "body" {
+			t.Errorf("body not restored; Got: %q", b)
+		}
+	})
+
+	t.Run("body too large", func(t *testing.T) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("POST", "/", strings.NewReader("too large body"))
+
+		if _, err := m.ExtractBodyDigest(c); !errors.Is(err, ErrBodyTooLarge) {
+			t.Errorf("ExtractBodyDigest(); Got: %v, Expected: %v", err, ErrBodyTooLarge)
+		}
+	})
+
+	t.Run("body too large response", func(t *testing.T) {
+		var rejected *VerificationError
+		m.OnRejected = func(c *gin.Context, err *VerificationError) { rejected = err }
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/", strings.NewReader("too large body"))
+		c.Request.Header.Set("X-Nonce", "nonce")
+		c.Request.Header.Set("X-Hash", "00")
+		m.VerifyNonceMiddleware(c)
+
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("unexpected status; Got: %v, Expected: %v", w.Code, http.StatusRequestEntityTooLarge)
+		}
+
+		if rejected == nil || rejected.Code != ReasonBodyTooLarge || rejected.Phase != PhaseExtract {
+			t.Errorf("unexpected rejection: %+v", rejected)
+		}
+	})
+}
+
+func TestMiddleware_VerifyBodyDigest(t *testing.T) {
+	m, _ := New(&Middleware{Difficulty: 4})
+
+	// the client appends its counter to the digest, as solver.Solver does
+	digest := BodyDigest("POST", "/", []byte("body"))
+	var counter, hash string
+	for i := 0; ; i++ {
+		counter = strconv.Itoa(i)
+		sum := sha256.Sum256([]byte(digest + counter + "nonce"))
+		if leadingZeroBits(sum[:]) >= 4 {
+			hash = hex.EncodeToString(sum[:])
+			break
+		}
+	}
+
+	r := gin.New()
+	r.POST("/", m.VerifyNonceMiddleware, func(c *gin.Context) {
+		b, _ := ioutil.ReadAll(c.Request.Body)
+		c.String(200, string(b))
+	})
+
+	tests := []struct {
+		name       string
+		body       string
+		expectCode int
+	}{
+		{"valid body", "body", 200},
+		{"tampered body", "tampered", 428},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+			req.Header.Set("X-Nonce", "nonce")
+			req.Header.Set("X-Hash", hash)
+			req.Header.Set("X-Hash-Counter", counter)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.expectCode {
+				t.Errorf("unexpected status; Got: %v, Expected: %v", w.Code, tt.expectCode)
+			}
+
+			if tt.expectCode == 200 && w.Body.String() != tt.body {
+				t.Errorf("body not passed to the next handler; Got: %q", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestHTTPMiddleware_ExtractBodyDigest(t *testing.T) {
+	m, _ := NewHTTP(&HTTPMiddleware{})
+
+	req := httptest.NewRequest("PUT", "/items/1", strings.NewReader("body"))
+	req.Header.Set("X-Hash-Counter", "7")
+
+	data, err := m.ExtractData(req)
+	if expect := BodyDigest("PUT", "/items/1", []byte("body")) + "7"; err != nil || data != expect {
+		t.Errorf("ExtractData(); Got: %v %v, Expected: %v", data, err, expect)
+	}
+}
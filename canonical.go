@@ -0,0 +1,267 @@
+package ginpow
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrInvalidJSON is the error of a request body that is not valid JSON, or lacks a field
+// selected by ExtractCanonicalJSON.
+var ErrInvalidJSON = errors.New("request body is not valid JSON")
+
+// CanonicalJSON returns a deterministic encoding of a JSON document, so that clients and
+// servers that serialize the same value differently compute the same data: objects have
+// their keys sorted, there is no whitespace, strings are not HTML escaped, and numbers are
+// formatted like the shortest representation of a float64, without an exponent for
+// integers, e.g. `1.0` and `1e0` both become `1`. Numbers are not rounded to a float64,
+// so that integers too large for one stay distinct.
+//
+// When fields are given, only the values at those paths are encoded, as a JSON array in
+// the order of fields. A path is a list of object keys and array indexes separated by
+// dots, e.g. `user.name` or `items.0.id`. It returns ErrInvalidJSON if the document is not
+// valid JSON or a field is missing.
+func CanonicalJSON(body []byte, fields ...string) (string, error) {
+	v, err := decodeJSON(body)
+	if err != nil {
+		return "", err
+	}
+
+	if len(fields) > 0 {
+		values := make([]interface{}, len(fields))
+		for i, field := range fields {
+			value, ok := lookupField(v, field)
+			if !ok {
+				return "", fmt.Errorf("%w: no field %q", ErrInvalidJSON, field)
+			}
+			values[i] = value
+		}
+		v = values
+	}
+
+	var buf bytes.Buffer
+	if err := writeCanonical(&buf, v); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// decodeJSON decodes a JSON document, keeping numbers as json.Number
+func decodeJSON(body []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidJSON, err)
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("%w: data after top-level value", ErrInvalidJSON)
+	}
+	return v, nil
+}
+
+// lookupField returns the value at a dot separated path
+func lookupField(v interface{}, path string) (interface{}, bool) {
+	for _, key := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			value, ok := node[key]
+			if !ok {
+				return nil, false
+			}
+			v = value
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			v = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// writeCanonical writes the canonical encoding of a decoded JSON value
+func writeCanonical(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case json.Number:
+		n, err := canonicalNumber(v)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(n)
+	case string:
+		writeCanonicalString(buf, v)
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, value := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonical(buf, value); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		buf.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeCanonicalString(buf, key)
+			buf.WriteByte(':')
+			if err := writeCanonical(buf, v[key]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	}
+	return nil
+}
+
+// writeCanonicalString writes a JSON string without HTML escaping
+func writeCanonicalString(buf *bytes.Buffer, s string) {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	// Encode terminates the value with a newline
+	buf.Truncate(buf.Len() - 1)
+}
+
+// canonicalNumber formats a JSON number from its decimal digits, so that no precision is lost.
+// Integers below 1e21 are written without an exponent, and other numbers like strconv.FormatFloat
+// with the 'g' format and the shortest precision. Numbers out of the range of a float64 are rejected.
+func canonicalNumber(n json.Number) (string, error) {
+	// numbers beyond the range of a float64 are rejected, as most clients can't hold them
+	if _, err := strconv.ParseFloat(string(n), 64); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidJSON, err)
+	}
+
+	s := string(n)
+
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	exp := 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		e, err := strconv.ParseInt(strings.TrimPrefix(s[i+1:], "+"), 10, 32)
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", ErrInvalidJSON, err)
+		}
+		exp = int(e)
+		s = s[:i]
+	}
+
+	// the value is 0.digits * 10^point
+	digits := s
+	point := len(s)
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		digits = s[:i] + s[i+1:]
+		point = i
+	}
+
+	trimmed := strings.TrimLeft(digits, "0")
+	point += exp - (len(digits) - len(trimmed))
+	digits = strings.TrimRight(trimmed, "0")
+
+	if digits == "" {
+		return "0", nil
+	}
+
+	var buf strings.Builder
+	if neg {
+		buf.WriteByte('-')
+	}
+
+	switch {
+	case point >= len(digits) && point <= 21:
+		// integer
+		buf.WriteString(digits)
+		buf.WriteString(strings.Repeat("0", point-len(digits)))
+	case point-1 < -4 || point-1 >= 6:
+		// exponent
+		buf.WriteByte(digits[0])
+		if len(digits) > 1 {
+			buf.WriteByte('.')
+			buf.WriteString(digits[1:])
+		}
+
+		e := point - 1
+		buf.WriteByte('e')
+		if e < 0 {
+			buf.WriteByte('-')
+			e = -e
+		} else {
+			buf.WriteByte('+')
+		}
+		if e < 10 {
+			buf.WriteByte('0')
+		}
+		buf.WriteString(strconv.Itoa(e))
+	case point <= 0:
+		// fraction below 1
+		buf.WriteString("0.")
+		buf.WriteString(strings.Repeat("0", -point))
+		buf.WriteString(digits)
+	default:
+		buf.WriteString(digits[:point])
+		buf.WriteByte('.')
+		buf.WriteString(digits[point:])
+	}
+	return buf.String(), nil
+}
+
+// canonicalRequest returns the CanonicalJSON of the body of a request followed by the counter on the `HashCounterHeader` header
+func (pow *Middleware) canonicalRequest(r *http.Request, fields []string) (string, error) {
+	body, err := readBody(r, pow.MaxBodySize)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := CanonicalJSON(body, fields...)
+	if err != nil {
+		return "", err
+	}
+	return data + r.Header.Get(pow.HashCounterHeader), nil
+}
+
+// ExtractCanonicalJSON returns an ExtractData that extracts the CanonicalJSON of the request
+// body, or of the given fields of it, followed by the counter on the `HashCounterHeader` header.
+// The body is restored so that the next handlers can read it. A body that is not valid JSON
+// is rejected with a 400, e.g. `pow.ExtractData = pow.ExtractCanonicalJSON("username", "password")`.
+func (pow *Middleware) ExtractCanonicalJSON(fields ...string) func(c *gin.Context) (string, error) {
+	return func(c *gin.Context) (string, error) {
+		return pow.canonicalRequest(c.Request, fields)
+	}
+}
+
+// ExtractCanonicalJSON returns an ExtractData that extracts the CanonicalJSON of the request
+// body. See `Middleware.ExtractCanonicalJSON`.
+func (pow *HTTPMiddleware) ExtractCanonicalJSON(fields ...string) func(r *http.Request) (string, error) {
+	return func(r *http.Request) (string, error) {
+		return pow.canonicalRequest(r, fields)
+	}
+}
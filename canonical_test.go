@@ -0,0 +1,131 @@
+package ginpow
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCanonicalJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		fields []string
+		expect string
+	}{
+		{"sorted keys", `{"b": 1, "a": {"d": true, "c": null}}`, nil, `{"a":{"c":null,"d":true},"b":1}`},
+		{"whitespace", "[ 1,\n\t2 ]", nil, `[1,2]`},
+		{"integers", `[1.0, 1e0, 10E1, -0, 1e21]`, nil, `[1,1,100,0,1e+21]`},
+		{"fractions", `[1.50, 0.1, 1e-7]`, nil, `[1.5,0.1,1e-07]`},
+		{"exponents", `[-1.25e-3, 123456.5, 1234567.5, 1.5e300, 12e20]`, nil, `[-0.00125,123456.5,1.2345675e+06,1.5e+300,1.2e+21]`},
+		{"strings", `["<a&b>", "é", "\"\\"]`, nil, `["<a&b>","é","\"\\"]`},
+		{"fields", `{"user": {"name": "jane"}, "items": [{"id": 3.0}], "x": 1}`, []string{"items.0.id", "user.name"}, `[3,"jane"]`},
+		{"object field", `{"user": {"name": "jane", "age": 30}}`, []string{"user"}, `[{"age":30,"name":"jane"}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CanonicalJSON([]byte(tt.body), tt.fields...)
+			if err != nil {
+				t.Fatalf("CanonicalJSON() returned error: %v", err)
+			}
+
+			if got != tt.expect {
+				t.Errorf("CanonicalJSON(); Got: %v, Expected: %v", got, tt.expect)
+			}
+		})
+	}
+
+	t.Run("large integers", func(t *testing.T) {
+		a, _ := CanonicalJSON([]byte(`{"id": 12345678901234567891}`))
+		b, _ := CanonicalJSON([]byte(`{"id": 12345678901234567892}`))
+
+		if a != `{"id":12345678901234567891}` || a == b {
+			t.Errorf("CanonicalJSON() rounded large integers; Got: %v and %v", a, b)
+		}
+	})
+
+	t.Run("same value, different serialization", func(t *testing.T) {
+		a, _ := CanonicalJSON([]byte(`{"counter": 42, "name": "x"}`))
+		b, _ := CanonicalJSON([]byte(`{ "name":"x", "counter":4.2e1 }`))
+
+		if a != b {
+			t.Errorf("CanonicalJSON() differs; %v != %v", a, b)
+		}
+	})
+
+	invalid := []struct {
+		name   string
+		body   string
+		fields []string
+	}{
+		{"not JSON", `{"a":`, nil},
+		{"trailing data", `{} {}`, nil},
+		{"missing field", `{"a": 1}`, []string{"b"}},
+		{"index out of range", `{"a": [1]}`, []string{"a.1"}},
+		{"field of a scalar", `{"a": 1}`, []string{"a.b"}},
+		{"number out of range", `1e400`, nil},
+	}
+
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := CanonicalJSON([]byte(tt.body), tt.fields...); !errors.Is(err, ErrInvalidJSON) {
+				t.Errorf("CanonicalJSON(); Got: %v, Expected: %v", err, ErrInvalidJSON)
+			}
+		})
+	}
+}
+
+func TestMiddleware_ExtractCanonicalJSON(t *testing.T) {
+	m, _ := New(&Middleware{})
+	m.ExtractData = m.ExtractCanonicalJSON("name")
+
+	t.Run("data", func(t *testing.T) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("POST", "/", strings.NewReader(`{"name": "jane", "other": 1}`))
+		c.Request.Header.Set("X-Hash-Counter", "42")
+
+		if data, err := m.ExtractData(c); err != nil || data != `["jane"]42` {
+			t.Errorf("ExtractData(); Got: %v %v, Expected: %v", data, err, `["jane"]42`)
+		}
+
+		if b, _ := ioutil.ReadAll(c.Request.Body); string(b) != `{"name": "jane", "other": 1}` {
+			t.Errorf("body not restored; Got: %q", b)
+		}
+	})
+
+	t.Run("invalid JSON", func(t *testing.T) {
+		var rejected *VerificationError
+		m.OnRejected = func(c *gin.Context, err *VerificationError) { rejected = err }
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/", strings.NewReader(`not json`))
+		c.Request.Header.Set("X-Nonce", "nonce")
+		c.Request.Header.Set("X-Hash", "00")
+		m.VerifyNonceMiddleware(c)
+
+		if w.Code != 400 {
+			t.Errorf("unexpected status; Got: %v, Expected: 400", w.Code)
+		}
+
+		if rejected == nil || rejected.Code != ReasonInvalidJSON || !errors.Is(rejected, ErrInvalidJSON) {
+			t.Errorf("unexpected rejection: %+v", rejected)
+		}
+	})
+}
+
+func TestHTTPMiddleware_ExtractCanonicalJSON(t *testing.T) {
+	m, _ := NewHTTP(&HTTPMiddleware{})
+	extract := m.ExtractCanonicalJSON()
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"b": 2.0, "a": 1}`))
+
+	if data, err := extract(req); err != nil || data != `{"a":1,"b":2}` {
+		t.Errorf("ExtractCanonicalJSON(); Got: %v %v", data, err)
+	}
+}
@@ -0,0 +1,271 @@
+package ginpow
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// challengeSeparator separates the random part of a nonce from the parameters
+// embedded in it. Each embedded parameter is a single letter tag followed by its value.
+// Because the parameters are part of the nonce, they are covered by the nonce
+// checksum when `Middleware.Check` is true and by the client's hash.
+const challengeSeparator = "."
+
+const (
+	issuedAtTag   = 't'
+	difficultyTag = 'd'
+	scopeTag      = 's'
+)
+
+var (
+	// ErrChallengeExpired is the reason given when a nonce was issued more than `Middleware.ChallengeTTL` ago.
+	ErrChallengeExpired = errors.New("nonce has expired")
+
+	// ErrChallengeNotYetValid is the reason given when a nonce claims to be issued in the future.
+	ErrChallengeNotYetValid = errors.New("nonce is not valid yet")
+
+	// ErrChallengeMalformed is the reason given when a nonce is missing parameters the middleware requires.
+	ErrChallengeMalformed = errors.New("nonce is malformed")
+
+	// ErrChallengeScopeMismatch is the reason given when a nonce was issued for another scope than the route it is presented to.
+	ErrChallengeScopeMismatch = errors.New("nonce was issued for another scope")
+)
+
+// timeNow is replaced in tests
+var timeNow = time.Now
+
+// challenge holds the parameters embedded in a nonce.
+type challenge struct {
+	issuedAt time.Time
+
+	difficulty    int
+	hasDifficulty bool
+
+	scope    string
+	hasScope bool
+}
+
+// encode appends the challenge parameters to a random nonce
+func (ch challenge) encode(random string) string {
+	var b strings.Builder
+	b.WriteString(random)
+
+	if !ch.issuedAt.IsZero() {
+		b.WriteString(challengeSeparator)
+		b.WriteByte(issuedAtTag)
+		b.WriteString(strconv.FormatInt(ch.issuedAt.Unix(), 10))
+	}
+
+	if ch.hasDifficulty {
+		b.WriteString(challengeSeparator)
+		b.WriteByte(difficultyTag)
+		b.WriteString(strconv.Itoa(ch.difficulty))
+	}
+
+	if ch.hasScope {
+		b.WriteString(challengeSeparator)
+		b.WriteByte(scopeTag)
+		b.WriteString(base64.RawURLEncoding.EncodeToString([]byte(ch.scope)))
+	}
+
+	return b.String()
+}
+
+// parseChallenge reads the parameters embedded in a nonce. Unknown tags are ignored.
+func parseChallenge(nonce string) (challenge, error) {
+	var ch challenge
+
+	fields := strings.Split(nonce, challengeSeparator)
+	for _, field := range fields[1:] {
+		if field == "" {
+			return ch, ErrChallengeMalformed
+		}
+
+		switch field[0] {
+		case issuedAtTag:
+			sec, err := strconv.ParseInt(field[1:], 10, 64)
+			if err != nil {
+				return ch, ErrChallengeMalformed
+			}
+			ch.issuedAt = time.Unix(sec, 0)
+		case difficultyTag:
+			d, err := strconv.Atoi(field[1:])
+			if err != nil || d < 0 {
+				return ch, ErrChallengeMalformed
+			}
+			ch.difficulty = d
+			ch.hasDifficulty = true
+		case scopeTag:
+			scope, err := base64.RawURLEncoding.DecodeString(field[1:])
+			if err != nil {
+				return ch, ErrChallengeMalformed
+			}
+			ch.scope = string(scope)
+			ch.hasScope = true
+		}
+	}
+
+	return ch, nil
+}
+
+// expiresAt returns when a challenge issued at issuedAt expires
+func (pow *Middleware) expiresAt(ch challenge) time.Time {
+	return ch.issuedAt.Add(pow.ChallengeTTL)
+}
+
+// parsesChallenge reports whether parameters embedded in nonces are read. Embedded
+// parameters are only trusted when they are covered by the nonce checksum.
+func (pow *Middleware) parsesChallenge() bool {
+	return pow.Check
+}
+
+// embedsDifficulty reports whether issued nonces carry the difficulty they were issued at
+func (pow *Middleware) embedsDifficulty() bool {
+	return pow.Adaptive != nil || pow.DifficultyFunc != nil
+}
+
+// currentDifficulty returns the difficulty new nonces are issued at,
+// before `DifficultyFunc` is consulted.
+func (pow *Middleware) currentDifficulty() int {
+	if pow.Adaptive != nil {
+		return pow.Adaptive.Difficulty()
+	}
+	return pow.Difficulty
+}
+
+// challengeDifficulty is the difficulty a nonce was issued at
+func (pow *Middleware) challengeDifficulty(ch challenge) int {
+	if ch.hasDifficulty && pow.Check {
+		return ch.difficulty
+	}
+	return pow.currentDifficulty()
+}
+
+// issuedChallenge reads the parameters of a nonce generated by this middleware
+func (pow *Middleware) issuedChallenge(nonce string) challenge {
+	if !pow.parsesChallenge() {
+		return challenge{}
+	}
+
+	ch, _ := parseChallenge(nonce)
+	return ch
+}
+
+// verifyChallenge parses and validates the parameters embedded in a nonce against the middleware config.
+// scope is the scope of the route the nonce is presented to, only checked when `Scopes` is set.
+func (pow *Middleware) verifyChallenge(nonce, scope string) (challenge, error) {
+	if !pow.parsesChallenge() {
+		return challenge{}, nil
+	}
+
+	ch, err := parseChallenge(nonce)
+	if err != nil {
+		return challenge{}, err
+	}
+
+	if pow.embedsDifficulty() && !ch.hasDifficulty {
+		return ch, ErrChallengeMalformed
+	}
+
+	if pow.ChallengeTTL > 0 {
+		if ch.issuedAt.IsZero() {
+			return ch, ErrChallengeMalformed
+		}
+
+		now := timeNow()
+		if ch.issuedAt.Unix() > now.Unix() {
+			return ch, ErrChallengeNotYetValid
+		}
+
+		if !now.Before(pow.expiresAt(ch)) {
+			return ch, ErrChallengeExpired
+		}
+	}
+
+	if len(pow.Scopes) > 0 {
+		if !ch.hasScope {
+			return ch, ErrChallengeMalformed
+		}
+
+		if ch.scope != scope {
+			return ch, ErrChallengeScopeMismatch
+		}
+	}
+
+	return ch, nil
+}
+
+// generateNonce generates a nonce with the configured challenge parameters embedded
+// and returns it with its hex encoded checksum. difficulty is the difficulty chosen
+// for the client, or negative to use the current difficulty. scope is the scope the
+// nonce is bound to when `Scopes` is set. client is the key of the client the nonce is
+// bound to when `Binding` is set. source is reported to `Metrics`.
+func (pow *Middleware) generateNonce(difficulty int, scope, client, source string) (string, string, error) {
+	random, randomChecksum, err := pow.Pow.GenerateNonce()
+	if err != nil {
+		return "", "", err
+	}
+	pow.observeIssue(source)
+
+	var ch challenge
+	if pow.ChallengeTTL > 0 {
+		ch.issuedAt = timeNow()
+	}
+
+	if difficulty >= 0 || pow.embedsDifficulty() {
+		if difficulty < 0 {
+			difficulty = pow.currentDifficulty()
+		}
+		if difficulty > pow.hashSize {
+			difficulty = pow.hashSize
+		}
+		ch.difficulty = difficulty
+		ch.hasDifficulty = true
+	}
+
+	if len(pow.Scopes) > 0 {
+		ch.scope = scope
+		ch.hasScope = true
+	}
+
+	nonce := ch.encode(string(random))
+	if nonce == string(random) && client == "" && pow.Keyring == nil {
+		return nonce, hex.EncodeToString(randomChecksum), nil
+	}
+
+	if !pow.Check {
+		return nonce, "", nil
+	}
+	return nonce, pow.checksum(nonce, client), nil
+}
+
+// checksum computes the hex encoded checksum of a nonce bound to client the same way as
+// gopow.Pow, prefixed with the id of the current key when `Keyring` is set
+func (pow *Middleware) checksum(nonce, client string) string {
+	id, secret := pow.signingKey()
+	return withKeyID(id, hex.EncodeToString(pow.checksumHash([]byte(nonce+secret+client))))
+}
+
+// checksumHash hashes a nonce checksum with `Hash`, or sha256 by default. `Algorithm` is
+// only applied to proofs, so that a checksum stays cheap to check.
+func (pow *Middleware) checksumHash(b []byte) []byte {
+	if pow.Hash != nil {
+		return pow.Hash(b)
+	}
+
+	sum := sha256.Sum256(b)
+	return sum[:]
+}
+
+// proofHash hashes a proof with `Algorithm` if set, otherwise like checksumHash
+func (pow *Middleware) proofHash(b []byte) []byte {
+	if pow.Algorithm != nil {
+		return pow.Algorithm.Sum(b)
+	}
+	return pow.checksumHash(b)
+}
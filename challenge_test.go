@@ -0,0 +1,293 @@
+package ginpow
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func withTimeNow(t *testing.T, now time.Time) *time.Time {
+	timeNow = func() time.Time { return now }
+	t.Cleanup(func() { timeNow = time.Now })
+	return &now
+}
+
+func TestChallenge_encode(t *testing.T) {
+	t.Run("no parameters", func(t *testing.T) {
+		if nonce := (challenge{}).encode("random"); nonce != "random" {
+			t.Errorf("nonce changed without parameters: %v", nonce)
+		}
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		issuedAt := time.Unix(1600000000, 0)
+		nonce := challenge{issuedAt: issuedAt}.encode("random")
+
+		if expect := "random.t1600000000"; nonce != expect {
+			t.Errorf("unexpected nonce; Got: %v, Expected: %v", nonce, expect)
+		}
+
+		ch, err := parseChallenge(nonce)
+		if err != nil {
+			t.Fatalf("parseChallenge() returned error: %v", err)
+		}
+
+		if !ch.issuedAt.Equal(issuedAt) {
+			t.Errorf("issue time not equal; Got: %v, Expected: %v", ch.issuedAt, issuedAt)
+		}
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		for _, nonce := range []string{"random.", "random.tabc", "random..t1", "random.dx", "random.d-1"} {
+			if _, err := parseChallenge(nonce); err != ErrChallengeMalformed {
+				t.Errorf("%v: expected %v, got %v", nonce, ErrChallengeMalformed, err)
+			}
+		}
+	})
+}
+
+func TestMiddleware_verifyChallenge(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	withTimeNow(t, now)
+
+	m, _ := New(&Middleware{
+		ExtractData:  func(c *gin.Context) (string, error) { return "", nil },
+		Check:        true,
+		ChallengeTTL: time.Minute,
+	})
+
+	tests := []struct {
+		name  string
+		nonce string
+		want  error
+	}{
+		{"valid", challenge{issuedAt: now.Add(-30 * time.Second)}.encode("n"), nil},
+		{"expired", challenge{issuedAt: now.Add(-time.Minute)}.encode("n"), ErrChallengeExpired},
+		{"future", challenge{issuedAt: now.Add(time.Second)}.encode("n"), ErrChallengeNotYetValid},
+		{"no issue time", "n", ErrChallengeMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := m.verifyChallenge(tt.nonce, ""); err != tt.want {
+				t.Errorf("verifyChallenge() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("ttl not set", func(t *testing.T) {
+		m, _ := New(&Middleware{
+			ExtractData: func(c *gin.Context) (string, error) { return "", nil },
+		})
+
+		if _, err := m.verifyChallenge("n.t0", ""); err != nil {
+			t.Errorf("verifyChallenge() returned error without ttl: %v", err)
+		}
+	})
+
+	t.Run("ttl without check", func(t *testing.T) {
+		if _, err := New(&Middleware{ChallengeTTL: time.Minute}); err == nil {
+			t.Error("New() did not error for ChallengeTTL without Check")
+		}
+	})
+}
+
+func TestMiddleware_ChallengeTTL(t *testing.T) {
+	now := withTimeNow(t, time.Unix(1600000000, 0))
+
+	m, _ := New(&Middleware{
+		ExtractData:  func(c *gin.Context) (string, error) { return "data", nil },
+		Check:        true,
+		Secret:       "secret",
+		ChallengeTTL: time.Minute,
+	})
+
+	t.Run("NonceHandler", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Accepted = []string{gin.MIMEJSON}
+
+		m.NonceHandler(c)
+
+		var j map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &j)
+
+		if expect := float64(now.Add(time.Minute).Unix()); j["expires"] != expect {
+			t.Errorf("unexpected expires; Got: %v, Expected: %v", j["expires"], expect)
+		}
+
+		nonce := j["nonce"].(string)
+		if !strings.HasSuffix(nonce, ".t1600000000") {
+			t.Errorf("issue time not embedded in nonce: %v", nonce)
+		}
+
+		calcHash := sha256.Sum256([]byte(nonce + "secret"))
+		if expect := hex.EncodeToString(calcHash[:]); j["nonce_checksum"] != expect {
+			t.Errorf("checksum does not cover embedded issue time; Got: %v, Expected: %v", j["nonce_checksum"], expect)
+		}
+	})
+
+	t.Run("NonceHeaderMiddleware", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("", "/", nil)
+
+		m.NonceHeaderMiddleware(c)
+
+		expect := strconv.FormatInt(now.Add(time.Minute).Unix(), 10)
+		if got := w.Result().Header.Get("X-Nonce-Expires"); got != expect {
+			t.Errorf("unexpected X-Nonce-Expires; Got: %v, Expected: %v", got, expect)
+		}
+	})
+
+	t.Run("VerifyNonceMiddleware", func(t *testing.T) {
+		nonce, nonceChecksum, _ := m.generateNonce(-1, "", "", SourceGenerateNonce)
+		sum := sha256.Sum256([]byte("data" + nonce))
+		hash := hex.EncodeToString(sum[:])
+
+		m.ExtractNonce = func(c *gin.Context) (string, string, error) { return nonce, nonceChecksum, nil }
+		m.ExtractHash = func(c *gin.Context) (string, error) { return hash, nil }
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		m.VerifyNonceMiddleware(c)
+
+		if len(c.Errors) > 0 {
+			t.Errorf("verification failed with error: %v", c.Errors)
+		}
+
+		*now = now.Add(time.Minute)
+
+		w = httptest.NewRecorder()
+		c, _ = gin.CreateTestContext(w)
+		m.VerifyNonceMiddleware(c)
+
+		if expect := 428; w.Code != expect {
+			t.Errorf("expired nonce didn't return %v but %v", expect, w.Code)
+		}
+
+		if last := c.Errors.Last(); last == nil || last.Error() != ErrChallengeExpired.Error() {
+			t.Errorf("unexpected error: %v", c.Errors)
+		}
+	})
+}
+
+func TestMiddleware_DifficultyFunc(t *testing.T) {
+	t.Run("requires check", func(t *testing.T) {
+		_, err := New(&Middleware{
+			ExtractData:    func(c *gin.Context) (string, error) { return "", nil },
+			DifficultyFunc: func(c *gin.Context) int { return 0 },
+		})
+
+		if err == nil {
+			t.Error("New() did not error when DifficultyFunc is set without Check")
+		}
+	})
+
+	m, _ := New(&Middleware{
+		ExtractData: func(c *gin.Context) (string, error) { return "data", nil },
+		Check:       true,
+		Secret:      "secret",
+		Difficulty:  16,
+		DifficultyFunc: func(c *gin.Context) int {
+			switch c.GetHeader("X-Api-Key") {
+			case "good":
+				return 0
+			case "suspicious":
+				return 1000
+			}
+			return -1
+		},
+	})
+
+	issue := func(apiKey string) map[string]interface{} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/", nil)
+		c.Request.Header.Set("X-Api-Key", apiKey)
+		c.Accepted = []string{gin.MIMEJSON}
+		m.NonceHandler(c)
+
+		var j map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &j)
+		return j
+	}
+
+	verify := func(nonce, nonceChecksum string) *gin.Context {
+		sum := sha256.Sum256([]byte("data" + nonce))
+		m.ExtractNonce = func(c *gin.Context) (string, string, error) { return nonce, nonceChecksum, nil }
+		m.ExtractHash = func(c *gin.Context) (string, error) { return hex.EncodeToString(sum[:]), nil }
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		m.VerifyNonceMiddleware(c)
+		return c
+	}
+
+	t.Run("per client difficulty", func(t *testing.T) {
+		if j := issue("good"); j["difficulty"] != float64(0) {
+			t.Errorf("good client difficulty; Got: %v, Expected: 0", j["difficulty"])
+		}
+
+		if j := issue("unknown"); j["difficulty"] != float64(16) {
+			t.Errorf("unknown client difficulty; Got: %v, Expected: 16", j["difficulty"])
+		}
+
+		if j := issue("suspicious"); j["difficulty"] != float64(256) {
+			t.Errorf("difficulty not capped to the hash size; Got: %v, Expected: 256", j["difficulty"])
+		}
+	})
+
+	t.Run("verifies at issued difficulty", func(t *testing.T) {
+		j := issue("good")
+
+		if c := verify(j["nonce"].(string), j["nonce_checksum"].(string)); len(c.Errors) > 0 {
+			t.Errorf("verification failed with error: %v", c.Errors)
+		}
+	})
+
+	t.Run("tampered difficulty", func(t *testing.T) {
+		j := issue("unknown")
+		nonce := strings.Replace(j["nonce"].(string), ".d16", ".d0", 1)
+
+		if c := verify(nonce, j["nonce_checksum"].(string)); len(c.Errors) == 0 {
+			t.Error("verification passed with tampered difficulty")
+		}
+	})
+
+	t.Run("hash size computed once", func(t *testing.T) {
+		calls := 0
+		m, _ := New(&Middleware{
+			Check:          true,
+			Hash:           func(b []byte) []byte { calls++; return make([]byte, 1) },
+			DifficultyFunc: func(c *gin.Context) int { return 1000 },
+		})
+		calls = 0
+
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/", nil)
+		nonce, _, _ := m.getNonce(c, SourceNonceHandler)
+		m.getNonce(c, SourceNonceHandler)
+
+		if !strings.HasSuffix(nonce, ".d8") {
+			t.Errorf("difficulty not capped to the hash size: %v", nonce)
+		}
+
+		// the checksums of the random part and of each nonce only
+		if calls != 4 {
+			t.Errorf("Hash calls; Got: %v, Expected: 4", calls)
+		}
+	})
+
+	t.Run("missing difficulty", func(t *testing.T) {
+		if _, err := m.verifyChallenge("random", ""); err != ErrChallengeMalformed {
+			t.Errorf("verifyChallenge() = %v, want %v", err, ErrChallengeMalformed)
+		}
+	})
+}
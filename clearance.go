@@ -0,0 +1,418 @@
+package ginpow
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	gonanoid "github.com/matoous/go-nanoid"
+)
+
+var (
+	// ErrClearanceInvalid is returned for a clearance token that is malformed or not signed by the middleware.
+	ErrClearanceInvalid = errors.New("clearance token is invalid")
+
+	// ErrClearanceExpired is returned for a clearance token older than `Clearance.TTL`.
+	ErrClearanceExpired = errors.New("clearance token has expired")
+
+	// ErrClearanceExhausted is returned for a clearance token used more than `Clearance.MaxUses` times.
+	ErrClearanceExhausted = errors.New("clearance token has been used up")
+
+	// ErrClearanceRevoked is returned for a clearance token that has been revoked.
+	ErrClearanceRevoked = errors.New("clearance token has been revoked")
+
+	// ErrClearanceMismatch is returned for a clearance token issued for another scope or client.
+	ErrClearanceMismatch = errors.New("clearance token was issued for another scope or client")
+)
+
+// clearanceSweepInterval is how often a MemoryClearanceStore removes expired tokens
+const clearanceSweepInterval = time.Minute
+
+// Clearance issues a signed clearance token after a successful verification that is
+// accepted by VerifyClearanceMiddleware in lieu of a new proof for a time, optionally
+// only for a number of requests. Tokens are signed with `Middleware.Secret`, or the current key of
+// `Middleware.Keyring`, so `Check` must be true. Like nonces, tokens are bound to the scope
+// of the route and the client they were issued for, when `Scopes` and `Binding` are set.
+type Clearance struct {
+	// TTL is how long a token is valid for. It is required so that `Store` can forget
+	//   tokens once they expire.
+	TTL time.Duration
+
+	// MaxUses is how many requests a token is valid for.
+	//   Defaults to 0, in which case tokens can be used until they expire.
+	MaxUses int
+
+	// Header is the name of the header a token is set on in responses and read from in requests.
+	//   Defaults to `X-Clearance`
+	Header string
+
+	// Cookie is the name of the cookie a token is set on in responses and read from in requests.
+	//   Optional. If not set then tokens are only sent in `Header`.
+	Cookie string
+
+	// CookiePath is the path of the cookie.
+	//   Defaults to `/`
+	CookiePath string
+
+	// CookieSecure marks the cookie as only sent over https.
+	//   Defaults to false.
+	CookieSecure bool
+
+	// Store counts the uses of tokens and records revoked tokens.
+	//   Defaults to a MemoryClearanceStore.
+	Store ClearanceStore
+}
+
+// validate returns an error if the config is invalid, before defaults are applied
+func (cl *Clearance) validate() error {
+	if cl.TTL <= 0 {
+		return errors.New("pow.Clearance.TTL must be positive")
+	}
+
+	if cl.MaxUses < 0 {
+		return errors.New("pow.Clearance.MaxUses must not be negative")
+	}
+	return nil
+}
+
+func (cl *Clearance) init() error {
+	if err := cl.validate(); err != nil {
+		return err
+	}
+
+	if cl.Header == "" {
+		cl.Header = "X-Clearance"
+	}
+
+	if cl.CookiePath == "" {
+		cl.CookiePath = "/"
+	}
+
+	if cl.Store == nil {
+		cl.Store = NewMemoryClearanceStore()
+	}
+
+	return nil
+}
+
+// ClearanceStore counts the uses of clearance tokens and records revoked tokens.
+type ClearanceStore interface {
+	// Use records a use of the token with the given id and returns the number of times
+	//   it has been used, including this one. It returns ErrClearanceRevoked if the token
+	//   has been revoked. expires is when the token expires, after which it can be forgotten.
+	Use(id string, expires time.Time) (int, error)
+
+	// Revoke revokes the token with the given id.
+	Revoke(id string, expires time.Time) error
+}
+
+// MemoryClearanceStore is an in-memory ClearanceStore that forgets tokens once they
+// expire. Uses and revocations are only known to the process that recorded them, so with
+// several instances a token can be used `MaxUses` times on each, and a token revoked on one
+// is still accepted by the others.
+type MemoryClearanceStore struct {
+	mu        sync.Mutex
+	tokens    map[string]*clearanceUses
+	lastSweep time.Time
+}
+
+type clearanceUses struct {
+	uses    int
+	revoked bool
+	expires time.Time
+}
+
+// NewMemoryClearanceStore returns an empty MemoryClearanceStore.
+func NewMemoryClearanceStore() *MemoryClearanceStore {
+	return &MemoryClearanceStore{tokens: make(map[string]*clearanceUses)}
+}
+
+// Use implements ClearanceStore.
+func (s *MemoryClearanceStore) Use(id string, expires time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := s.token(id, expires)
+	if t.revoked {
+		return t.uses, ErrClearanceRevoked
+	}
+	t.uses++
+	return t.uses, nil
+}
+
+// Revoke implements ClearanceStore.
+func (s *MemoryClearanceStore) Revoke(id string, expires time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.token(id, expires).revoked = true
+	return nil
+}
+
+// Len returns the number of tokens currently remembered.
+func (s *MemoryClearanceStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.tokens)
+}
+
+// token returns the uses of a token, sweeping expired tokens first
+func (s *MemoryClearanceStore) token(id string, expires time.Time) *clearanceUses {
+	if s.tokens == nil {
+		s.tokens = make(map[string]*clearanceUses)
+	}
+
+	now := timeNow()
+	if now.Sub(s.lastSweep) >= clearanceSweepInterval {
+		for id, t := range s.tokens {
+			if !now.Before(t.expires) {
+				delete(s.tokens, id)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	t, exists := s.tokens[id]
+	if !exists {
+		t = &clearanceUses{expires: expires}
+		s.tokens[id] = t
+	}
+	return t
+}
+
+// clearanceToken is the id and expiry of a clearance token, and the scope and client binding
+// of the request it was issued for
+type clearanceToken struct {
+	id      string
+	expires time.Time
+	scope   string
+	client  string
+}
+
+// payload is the signed part of a token
+func (t clearanceToken) payload() string {
+	return strings.Join([]string{
+		t.id,
+		strconv.FormatInt(t.expires.Unix(), 10),
+		base64.RawURLEncoding.EncodeToString([]byte(t.scope)),
+		t.client,
+	}, challengeSeparator)
+}
+
+// sign returns the hex encoded signature of a token payload with secret
+func sign(payload, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("clearance" + challengeSeparator + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// issueClearance returns a new signed clearance token bound to scope and client
+func (pow *Middleware) issueClearance(scope, client string) (string, error) {
+	id, err := gonanoid.ID(21)
+	if err != nil {
+		return "", err
+	}
+
+	t := clearanceToken{id: id, expires: timeNow().Add(pow.Clearance.TTL), scope: scope, client: client}
+
+	keyID, secret := pow.signingKey()
+	payload := t.payload()
+	return payload + challengeSeparator + withKeyID(keyID, sign(payload, secret)), nil
+}
+
+// parseClearance checks the signature and expiry of a clearance token
+func (pow *Middleware) parseClearance(token string) (clearanceToken, error) {
+	var t clearanceToken
+
+	i := strings.LastIndex(token, challengeSeparator)
+	if i < 0 {
+		return t, ErrClearanceInvalid
+	}
+
+	payload := token[:i]
+	secret, signature, err := pow.verificationKey(token[i+1:])
+	if err != nil || !hmac.Equal([]byte(signature), []byte(sign(payload, secret))) {
+		return t, ErrClearanceInvalid
+	}
+
+	fields := strings.Split(payload, challengeSeparator)
+	if len(fields) != 4 {
+		return t, ErrClearanceInvalid
+	}
+
+	exp, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || exp <= 0 {
+		return t, ErrClearanceInvalid
+	}
+
+	scope, err := base64.RawURLEncoding.DecodeString(fields[2])
+	if err != nil {
+		return t, ErrClearanceInvalid
+	}
+
+	t.id = fields[0]
+	t.expires = time.Unix(exp, 0)
+	t.scope = string(scope)
+	t.client = fields[3]
+	if !timeNow().Before(t.expires) {
+		return t, ErrClearanceExpired
+	}
+
+	return t, nil
+}
+
+// useClearance checks a clearance token presented to a request with scope and client,
+// and counts a use of it
+func (pow *Middleware) useClearance(token, scope, client string) error {
+	if token == "" {
+		return ErrClearanceInvalid
+	}
+
+	t, err := pow.parseClearance(token)
+	if err != nil {
+		return err
+	}
+
+	if t.scope != scope || t.client != client {
+		return ErrClearanceMismatch
+	}
+
+	uses, err := pow.Clearance.Store.Use(t.id, t.expires)
+	if err != nil {
+		return err
+	}
+
+	if pow.Clearance.MaxUses > 0 && uses > pow.Clearance.MaxUses {
+		return ErrClearanceExhausted
+	}
+	return nil
+}
+
+// RevokeClearance revokes a clearance token so it is no longer accepted.
+func (pow *Middleware) RevokeClearance(token string) error {
+	if pow.Clearance == nil {
+		return errors.New("pow.Clearance not declared")
+	}
+
+	t, err := pow.parseClearance(token)
+	if err == ErrClearanceExpired {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return pow.Clearance.Store.Revoke(t.id, t.expires)
+}
+
+// setClearance issues a clearance token bound to scope and client on the headers of a response
+func (pow *Middleware) setClearance(header http.Header, scope, client string) error {
+	token, err := pow.issueClearance(scope, client)
+	if err != nil {
+		return err
+	}
+
+	header.Set(pow.Clearance.Header, token)
+
+	if pow.Clearance.Cookie != "" {
+		cookie := &http.Cookie{
+			Name:     pow.Clearance.Cookie,
+			Value:    token,
+			Path:     pow.Clearance.CookiePath,
+			Secure:   pow.Clearance.CookieSecure,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		}
+		cookie.MaxAge = int(pow.Clearance.TTL / time.Second)
+		header.Add("Set-Cookie", cookie.String())
+	}
+
+	return nil
+}
+
+// requestClearance reads a clearance token from a request
+func (pow *Middleware) requestClearance(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+
+	if token := r.Header.Get(pow.Clearance.Header); token != "" {
+		return token
+	}
+
+	if pow.Clearance.Cookie != "" {
+		if cookie, err := r.Cookie(pow.Clearance.Cookie); err == nil {
+			return cookie.Value
+		}
+	}
+
+	return ""
+}
+
+// verifyClearance checks the clearance token of a request with scope and client, and
+// returns the result of letting it through, or false if it has no valid token
+func (pow *Middleware) verifyClearance(r *http.Request, scope, client string) (*VerificationResult, bool) {
+	if pow.Clearance == nil {
+		return nil, false
+	}
+
+	start := time.Now()
+	if pow.useClearance(pow.requestClearance(r), scope, client) != nil {
+		return nil, false
+	}
+	pow.observeVerification(start, nil)
+
+	return &VerificationResult{
+		Passed:     true,
+		Clearance:  true,
+		Scope:      scope,
+		VerifyTime: time.Since(start),
+	}, true
+}
+
+// VerifyClearanceMiddleware passes to the next handler if the request carries a valid
+// clearance token issued by a previous verification for the same scope and client, and
+// sets the result in the context like VerifyNonceMiddleware. Otherwise, it verifies a
+// proof like VerifyNonceMiddleware, which issues a new token on success.
+func (pow *Middleware) VerifyClearanceMiddleware(c *gin.Context) {
+	if res, ok := pow.verifyClearance(c.Request, pow.routeScope(c), pow.clientBinding(c.Request)); ok {
+		c.Set(resultContextKey, res)
+
+		if pow.OnVerified != nil {
+			pow.OnVerified(c, res)
+		}
+		return
+	}
+
+	pow.VerifyNonceMiddleware(c)
+}
+
+// VerifyClearanceMiddleware calls the next handler if the request carries a valid
+// clearance token issued by a previous verification for the same scope and client, and
+// sets the result in the request context like VerifyNonceMiddleware. Otherwise, it
+// verifies a proof like VerifyNonceMiddleware, which issues a new token on success.
+func (pow *HTTPMiddleware) VerifyClearanceMiddleware(next http.Handler) http.Handler {
+	verify := pow.VerifyNonceMiddleware(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if res, ok := pow.verifyClearance(r, pow.routeScope(r), pow.clientBinding(r)); ok {
+			r = r.WithContext(withResult(r.Context(), res))
+
+			if pow.OnVerified != nil {
+				pow.OnVerified(r, res)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		verify.ServeHTTP(w, r)
+	})
+}
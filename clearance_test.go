@@ -0,0 +1,291 @@
+package ginpow
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestClearance_init(t *testing.T) {
+	t.Run("requires check", func(t *testing.T) {
+		_, err := New(&Middleware{
+			ExtractData: func(c *gin.Context) (string, error) { return "", nil },
+			Clearance:   &Clearance{TTL: time.Minute},
+		})
+
+		if err == nil {
+			t.Error("New() did not error when Clearance is set without Check")
+		}
+	})
+
+	t.Run("requires TTL", func(t *testing.T) {
+		_, err := New(&Middleware{
+			ExtractData: func(c *gin.Context) (string, error) { return "", nil },
+			Check:       true,
+			Clearance:   &Clearance{MaxUses: 1},
+		})
+
+		if err == nil {
+			t.Error("New() did not error when Clearance has no TTL")
+		}
+	})
+}
+
+func TestMiddleware_VerifyClearanceMiddleware(t *testing.T) {
+	newMiddleware := func(cl *Clearance) *Middleware {
+		m, err := New(&Middleware{
+			ExtractData: func(c *gin.Context) (string, error) { return "data", nil },
+			Check:       true,
+			Clearance:   cl,
+		})
+		if err != nil {
+			t.Fatalf("New() returned error: %v", err)
+		}
+		return m
+	}
+
+	// solve passes VerifyClearanceMiddleware with a proof and returns the issued response
+	solve := func(m *Middleware) *httptest.ResponseRecorder {
+		nonce, nonceChecksum, _ := m.generateNonce(-1, "", "", SourceGenerateNonce)
+		sum := sha256.Sum256([]byte("data" + nonce))
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/", nil)
+		c.Request.Header.Set("X-Nonce", nonce)
+		c.Request.Header.Set("X-Nonce-Checksum", nonceChecksum)
+		c.Request.Header.Set("X-Hash", hex.EncodeToString(sum[:]))
+		m.VerifyClearanceMiddleware(c)
+
+		if c.IsAborted() {
+			t.Fatalf("verification with proof failed: %v", c.Errors)
+		}
+		return w
+	}
+
+	// pass reports whether a request with only a clearance token passes
+	pass := func(m *Middleware, token string) bool {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/", nil)
+		c.Request.Header.Set("X-Clearance", token)
+		m.VerifyClearanceMiddleware(c)
+		return !c.IsAborted()
+	}
+
+	t.Run("issues token on success", func(t *testing.T) {
+		m := newMiddleware(&Clearance{TTL: time.Minute})
+
+		if token := solve(m).Header().Get("X-Clearance"); token == "" {
+			t.Error("no clearance token issued")
+		}
+	})
+
+	t.Run("accepts token in lieu of proof", func(t *testing.T) {
+		m := newMiddleware(&Clearance{TTL: time.Minute})
+		token := solve(m).Header().Get("X-Clearance")
+
+		for i := 0; i < 3; i++ {
+			if !pass(m, token) {
+				t.Fatalf("request %v with clearance token failed", i+1)
+			}
+		}
+	})
+
+	t.Run("max uses", func(t *testing.T) {
+		m := newMiddleware(&Clearance{TTL: time.Minute, MaxUses: 2})
+		token := solve(m).Header().Get("X-Clearance")
+
+		if !pass(m, token) || !pass(m, token) {
+			t.Fatal("request with clearance token failed")
+		}
+
+		if pass(m, token) {
+			t.Error("clearance token accepted after MaxUses")
+		}
+	})
+
+	t.Run("expires", func(t *testing.T) {
+		now := withTimeNow(t, time.Unix(1600000000, 0))
+		m := newMiddleware(&Clearance{TTL: time.Minute})
+		token := solve(m).Header().Get("X-Clearance")
+
+		*now = now.Add(time.Minute)
+		if pass(m, token) {
+			t.Error("clearance token accepted after TTL")
+		}
+	})
+
+	t.Run("revoked", func(t *testing.T) {
+		m := newMiddleware(&Clearance{TTL: time.Minute})
+		token := solve(m).Header().Get("X-Clearance")
+
+		if err := m.RevokeClearance(token); err != nil {
+			t.Fatalf("RevokeClearance() returned error: %v", err)
+		}
+
+		if pass(m, token) {
+			t.Error("clearance token accepted after being revoked")
+		}
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		withTimeNow(t, time.Unix(1600000000, 0))
+		m := newMiddleware(&Clearance{TTL: time.Minute})
+		token := solve(m).Header().Get("X-Clearance")
+
+		// extend the expiry of the token
+		tampered := strings.Replace(token, ".1600000060.", ".1600000120.", 1)
+		if pass(m, tampered) {
+			t.Error("tampered clearance token accepted")
+		}
+	})
+
+	t.Run("signed with secret", func(t *testing.T) {
+		m := newMiddleware(&Clearance{TTL: time.Minute})
+		token := solve(m).Header().Get("X-Clearance")
+
+		other := newMiddleware(&Clearance{TTL: time.Minute})
+		if pass(other, token) {
+			t.Error("clearance token accepted by middleware with another secret")
+		}
+	})
+
+	t.Run("cookie", func(t *testing.T) {
+		m := newMiddleware(&Clearance{TTL: time.Minute, Cookie: "clearance"})
+		res := solve(m).Result()
+
+		var cookie *http.Cookie
+		for _, c := range res.Cookies() {
+			if c.Name == "clearance" {
+				cookie = c
+			}
+		}
+
+		if cookie == nil {
+			t.Fatal("no clearance cookie set")
+		}
+
+		if !cookie.HttpOnly || cookie.MaxAge != 60 {
+			t.Errorf("clearance cookie; Got: %+v", cookie)
+		}
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/", nil)
+		c.Request.AddCookie(cookie)
+		m.VerifyClearanceMiddleware(c)
+
+		if c.IsAborted() {
+			t.Error("request with clearance cookie failed")
+		}
+	})
+
+	t.Run("sets result", func(t *testing.T) {
+		m := newMiddleware(&Clearance{TTL: time.Minute})
+		token := solve(m).Header().Get("X-Clearance")
+
+		var verified *VerificationResult
+		m.OnVerified = func(c *gin.Context, res *VerificationResult) { verified = res }
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/", nil)
+		c.Request.Header.Set("X-Clearance", token)
+		m.VerifyClearanceMiddleware(c)
+
+		res, ok := Result(c)
+		if !ok || !res.Passed || !res.Clearance {
+			t.Errorf("Result(); Got: %+v %v", res, ok)
+		}
+
+		if verified != res {
+			t.Errorf("OnVerified not called with the result; Got: %+v", verified)
+		}
+	})
+
+	t.Run("bound to scope and client", func(t *testing.T) {
+		m, err := New(&Middleware{
+			ExtractData: func(c *gin.Context) (string, error) { return "data", nil },
+			Check:       true,
+			Scopes:      []string{"GET /cheap", "POST /login"},
+			Binding:     &Binding{ClientIP: true},
+			Clearance:   &Clearance{TTL: time.Minute},
+		})
+		if err != nil {
+			t.Fatalf("New() returned error: %v", err)
+		}
+
+		r := gin.New()
+		r.GET("/cheap", m.VerifyClearanceMiddleware)
+		r.POST("/login", m.VerifyClearanceMiddleware)
+
+		req := httptest.NewRequest("GET", "/cheap", nil)
+		req.RemoteAddr = "1.1.1.1:1234"
+		nonce, nonceChecksum, _ := m.generateNonce(-1, "GET /cheap", m.clientBinding(req), SourceGenerateNonce)
+		sum := sha256.Sum256([]byte("data" + nonce))
+		req.Header.Set("X-Nonce", nonce)
+		req.Header.Set("X-Nonce-Checksum", nonceChecksum)
+		req.Header.Set("X-Hash", hex.EncodeToString(sum[:]))
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		token := w.Header().Get("X-Clearance")
+		if w.Code != 200 || token == "" {
+			t.Fatalf("verification with proof failed; Got: %v %q", w.Code, w.Body.String())
+		}
+
+		tests := []struct {
+			name         string
+			method, path string
+			remoteAddr   string
+			pass         bool
+		}{
+			{"same scope and client", "GET", "/cheap", "1.1.1.1:4321", true},
+			{"other client", "GET", "/cheap", "2.2.2.2:1234", false},
+			{"other scope", "POST", "/login", "1.1.1.1:1234", false},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				req := httptest.NewRequest(tt.method, tt.path, nil)
+				req.RemoteAddr = tt.remoteAddr
+				req.Header.Set("X-Clearance", token)
+
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+				if pass := w.Code == 200; pass != tt.pass {
+					t.Errorf("passed; Got: %v, Expected: %v", pass, tt.pass)
+				}
+			})
+		}
+	})
+
+	t.Run("falls back to proof", func(t *testing.T) {
+		m := newMiddleware(&Clearance{TTL: time.Minute})
+
+		if pass(m, "") {
+			t.Error("request without clearance token or proof passed")
+		}
+	})
+}
+
+func TestMemoryClearanceStore(t *testing.T) {
+	now := withTimeNow(t, time.Unix(1600000000, 0))
+	s := NewMemoryClearanceStore()
+
+	s.Use("a", now.Add(time.Second))
+	s.Use("b", now.Add(time.Hour))
+
+	*now = now.Add(clearanceSweepInterval)
+	s.Use("c", now.Add(time.Second))
+
+	if s.Len() != 2 {
+		t.Errorf("Len(); Got: %v, Expected: 2", s.Len())
+	}
+}
@@ -0,0 +1,351 @@
+package ginpow
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// EnvPrefix is the prefix of the environment variables read by LoadConfig.
+const EnvPrefix = "GINPOW_"
+
+// Duration is a time.Duration that is read from a string such as `30s` or `5m`.
+type Duration time.Duration
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// Config is the config of a Middleware that can be loaded from a YAML or JSON file and
+// environment variables, see LoadConfig. Each field is read from the key of its yaml tag,
+// or the environment variable of the upper cased key prefixed with EnvPrefix, e.g.
+// `difficulty` and `GINPOW_DIFFICULTY`. Lists are comma separated in environment variables.
+// The fields set the Middleware fields of the same name, except as documented below.
+type Config struct {
+	Difficulty   int      `yaml:"difficulty" json:"difficulty"`
+	NonceLength  int      `yaml:"nonce_length" json:"nonce_length"`
+	Check        bool     `yaml:"check" json:"check"`
+	ChallengeTTL Duration `yaml:"challenge_ttl" json:"challenge_ttl"`
+	Scopes       []string `yaml:"scopes" json:"scopes"`
+
+	// Secret, or the contents of SecretFile without trailing whitespace, is the secret
+	//   nonce checksums are computed with. Either sets `Check`.
+	Secret     string `yaml:"secret" json:"secret"`
+	SecretFile string `yaml:"secret_file" json:"secret_file"`
+
+	// Algorithm and AlgorithmParams are the name and parameters of the hash algorithm,
+	//   as advertised by a Middleware, e.g. `argon2id` and `m=16384,t=1,p=1,l=32`.
+	//   See ParseHashAlgorithm.
+	Algorithm       string `yaml:"algorithm" json:"algorithm"`
+	AlgorithmParams string `yaml:"algorithm_params" json:"algorithm_params"`
+
+	NonceHeader          string `yaml:"nonce_header" json:"nonce_header"`
+	NonceChecksumHeader  string `yaml:"nonce_checksum_header" json:"nonce_checksum_header"`
+	HashDifficultyHeader string `yaml:"hash_difficulty_header" json:"hash_difficulty_header"`
+	NonceExpiresHeader   string `yaml:"nonce_expires_header" json:"nonce_expires_header"`
+	HashAlgorithmHeader  string `yaml:"hash_algorithm_header" json:"hash_algorithm_header"`
+	HashParamsHeader     string `yaml:"hash_params_header" json:"hash_params_header"`
+	HashCounterHeader    string `yaml:"hash_counter_header" json:"hash_counter_header"`
+	NonceScopeHeader     string `yaml:"nonce_scope_header" json:"nonce_scope_header"`
+
+	NonceSource         string `yaml:"nonce_source" json:"nonce_source"`
+	NonceChecksumSource string `yaml:"nonce_checksum_source" json:"nonce_checksum_source"`
+	HashSource          string `yaml:"hash_source" json:"hash_source"`
+	DataSource          string `yaml:"data_source" json:"data_source"`
+
+	NonceDataKey          string `yaml:"nonce_data_key" json:"nonce_data_key"`
+	NonceChecksumDataKey  string `yaml:"nonce_checksum_data_key" json:"nonce_checksum_data_key"`
+	HashDifficultyDataKey string `yaml:"hash_difficulty_data_key" json:"hash_difficulty_data_key"`
+	NonceExpiresDataKey   string `yaml:"nonce_expires_data_key" json:"nonce_expires_data_key"`
+	HashAlgorithmDataKey  string `yaml:"hash_algorithm_data_key" json:"hash_algorithm_data_key"`
+	HashParamsDataKey     string `yaml:"hash_params_data_key" json:"hash_params_data_key"`
+	NonceScopeDataKey     string `yaml:"nonce_scope_data_key" json:"nonce_scope_data_key"`
+
+	MaxBodySize        int64  `yaml:"max_body_size" json:"max_body_size"`
+	FailureStatusCode  int    `yaml:"failure_status_code" json:"failure_status_code"`
+	ChallengeOnFailure bool   `yaml:"challenge_on_failure" json:"challenge_on_failure"`
+	ProblemDetails     bool   `yaml:"problem_details" json:"problem_details"`
+	NonceURL           string `yaml:"nonce_url" json:"nonce_url"`
+	ReportOnly         bool   `yaml:"report_only" json:"report_only"`
+	EnforcePercent     int    `yaml:"enforce_percent" json:"enforce_percent"`
+
+	// ClearanceTTL sets `Clearance.TTL`, with a default Clearance if the Middleware has
+	//   none. Setting it to 0 in a file or the environment removes the Clearance.
+	ClearanceTTL Duration `yaml:"clearance_ttl" json:"clearance_ttl"`
+
+	// present are the keys set in the file and the environment the config was read from
+	present map[string]bool
+}
+
+// LoadConfig reads a Config from a YAML or JSON file, chosen by its `.yaml`, `.yml` or
+// `.json` extension, and then from the environment variables, which take precedence.
+// If path is empty then it is read from `GINPOW_CONFIG`, and if that is empty too, the
+// Config is only read from the environment. Unknown keys in the file are an error.
+func LoadConfig(path string) (*Config, error) {
+	cfg := &Config{}
+
+	if path == "" {
+		path = os.Getenv(EnvPrefix + "CONFIG")
+	}
+
+	if path != "" {
+		if err := cfg.readFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if errs := cfg.readEnv(os.LookupEnv); len(errs) > 0 {
+		return nil, &ConfigError{Errors: errs}
+	}
+	return cfg, nil
+}
+
+// readFile reads a YAML or JSON config file, recording the keys set in it
+func (cfg *Config) readFile(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	keys := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if err = yaml.UnmarshalStrict(b, cfg); err == nil {
+			err = yaml.Unmarshal(b, &keys)
+		}
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		if err = dec.Decode(cfg); err == nil {
+			err = json.Unmarshal(b, &keys)
+		}
+	default:
+		return fmt.Errorf("config file %v is not .yaml, .yml or .json", path)
+	}
+
+	if err != nil {
+		return fmt.Errorf("config file %v: %v", path, err)
+	}
+
+	for key := range keys {
+		cfg.setPresent(key)
+	}
+	return nil
+}
+
+// setPresent records that key was set, so that it is applied even if it is a zero value
+func (cfg *Config) setPresent(key string) {
+	if cfg.present == nil {
+		cfg.present = make(map[string]bool)
+	}
+	cfg.present[key] = true
+}
+
+// readEnv reads the fields of the config from the environment variables found by lookup
+func (cfg *Config) readEnv(lookup func(key string) (string, bool)) []error {
+	var errs []error
+
+	v := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Tag.Get("yaml")
+		if name == "" {
+			continue
+		}
+		key := EnvPrefix + strings.ToUpper(name)
+
+		s, ok := lookup(key)
+		if !ok {
+			continue
+		}
+
+		if err := setField(v.Field(i), s); err != nil {
+			errs = append(errs, fmt.Errorf("%v: %v", key, err))
+			continue
+		}
+		cfg.setPresent(name)
+	}
+	return errs
+}
+
+// setField sets a field of a Config from the value of an environment variable
+func setField(field reflect.Value, s string) error {
+	if u, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Slice:
+		var values []string
+		for _, value := range strings.Split(s, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+		field.Set(reflect.ValueOf(values))
+	}
+	return nil
+}
+
+// Middleware returns a Middleware with the config, to set the callbacks of and pass to New.
+func (cfg *Config) Middleware() (*Middleware, error) {
+	pow := &Middleware{}
+	if err := cfg.Apply(pow); err != nil {
+		return nil, err
+	}
+	return pow, nil
+}
+
+// Apply sets the fields of pow that are set in the config, so that a config can tune a
+// Middleware that is otherwise set in code. A field set in the file or the environment the
+// config was read from is applied even if it is a zero value, e.g. `GINPOW_REPORT_ONLY=false`.
+// Other zero values are left unset. It must be called before New.
+func (cfg *Config) Apply(pow *Middleware) error {
+	var errs []error
+
+	setString := func(dst *string, key string, v string) {
+		if v != "" || cfg.present[key] {
+			*dst = v
+		}
+	}
+	setInt := func(dst *int, key string, v int) {
+		if v != 0 || cfg.present[key] {
+			*dst = v
+		}
+	}
+	setBool := func(dst *bool, key string, v bool) {
+		if v || cfg.present[key] {
+			*dst = v
+		}
+	}
+
+	setInt(&pow.Difficulty, "difficulty", cfg.Difficulty)
+	setInt(&pow.NonceLength, "nonce_length", cfg.NonceLength)
+	setBool(&pow.Check, "check", cfg.Check)
+	if cfg.ChallengeTTL != 0 || cfg.present["challenge_ttl"] {
+		pow.ChallengeTTL = time.Duration(cfg.ChallengeTTL)
+	}
+	if len(cfg.Scopes) > 0 || cfg.present["scopes"] {
+		pow.Scopes = cfg.Scopes
+	}
+
+	secret, err := cfg.secret()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if secret != "" {
+		pow.Check = true
+		pow.Secret = secret
+	}
+
+	if cfg.Algorithm != "" {
+		alg, err := ParseHashAlgorithm(cfg.Algorithm, cfg.AlgorithmParams)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("algorithm: %v", err))
+		} else {
+			pow.Algorithm = alg
+		}
+	} else if cfg.AlgorithmParams != "" {
+		errs = append(errs, errors.New("algorithm_params requires algorithm"))
+	} else if cfg.present["algorithm"] {
+		pow.Algorithm = nil
+	}
+
+	setString(&pow.NonceHeader, "nonce_header", cfg.NonceHeader)
+	setString(&pow.NonceChecksumHeader, "nonce_checksum_header", cfg.NonceChecksumHeader)
+	setString(&pow.HashDifficultyHeader, "hash_difficulty_header", cfg.HashDifficultyHeader)
+	setString(&pow.NonceExpiresHeader, "nonce_expires_header", cfg.NonceExpiresHeader)
+	setString(&pow.HashAlgorithmHeader, "hash_algorithm_header", cfg.HashAlgorithmHeader)
+	setString(&pow.HashParamsHeader, "hash_params_header", cfg.HashParamsHeader)
+	setString(&pow.HashCounterHeader, "hash_counter_header", cfg.HashCounterHeader)
+	setString(&pow.NonceScopeHeader, "nonce_scope_header", cfg.NonceScopeHeader)
+
+	setString(&pow.NonceSource, "nonce_source", cfg.NonceSource)
+	setString(&pow.NonceChecksumSource, "nonce_checksum_source", cfg.NonceChecksumSource)
+	setString(&pow.HashSource, "hash_source", cfg.HashSource)
+	setString(&pow.DataSource, "data_source", cfg.DataSource)
+
+	setString(&pow.NonceDataKey, "nonce_data_key", cfg.NonceDataKey)
+	setString(&pow.NonceChecksumDataKey, "nonce_checksum_data_key", cfg.NonceChecksumDataKey)
+	setString(&pow.HashDifficultyDataKey, "hash_difficulty_data_key", cfg.HashDifficultyDataKey)
+	setString(&pow.NonceExpiresDataKey, "nonce_expires_data_key", cfg.NonceExpiresDataKey)
+	setString(&pow.HashAlgorithmDataKey, "hash_algorithm_data_key", cfg.HashAlgorithmDataKey)
+	setString(&pow.HashParamsDataKey, "hash_params_data_key", cfg.HashParamsDataKey)
+	setString(&pow.NonceScopeDataKey, "nonce_scope_data_key", cfg.NonceScopeDataKey)
+
+	if cfg.MaxBodySize != 0 || cfg.present["max_body_size"] {
+		pow.MaxBodySize = cfg.MaxBodySize
+	}
+	setInt(&pow.FailureStatusCode, "failure_status_code", cfg.FailureStatusCode)
+	setBool(&pow.ChallengeOnFailure, "challenge_on_failure", cfg.ChallengeOnFailure)
+	setBool(&pow.ProblemDetails, "problem_details", cfg.ProblemDetails)
+	setString(&pow.NonceURL, "nonce_url", cfg.NonceURL)
+	setBool(&pow.ReportOnly, "report_only", cfg.ReportOnly)
+	setInt(&pow.EnforcePercent, "enforce_percent", cfg.EnforcePercent)
+
+	if cfg.ClearanceTTL != 0 {
+		if pow.Clearance == nil {
+			pow.Clearance = &Clearance{}
+		}
+		pow.Clearance.TTL = time.Duration(cfg.ClearanceTTL)
+	} else if cfg.present["clearance_ttl"] {
+		pow.Clearance = nil
+	}
+
+	if len(errs) > 0 {
+		return &ConfigError{Errors: errs}
+	}
+	return nil
+}
+
+// secret returns Secret, or the contents of SecretFile
+func (cfg *Config) secret() (string, error) {
+	if cfg.SecretFile == "" {
+		return cfg.Secret, nil
+	}
+
+	if cfg.Secret != "" {
+		return "", errors.New("secret and secret_file can't both be set")
+	}
+
+	b, err := ioutil.ReadFile(cfg.SecretFile)
+	if err != nil {
+		return "", fmt.Errorf("secret_file: %v", err)
+	}
+	return strings.TrimRight(string(b), " \t\r\n"), nil
+}
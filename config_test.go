@@ -0,0 +1,231 @@
+package ginpow
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeFile writes a file in a temporary directory and returns its path
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// withEnv sets an environment variable for the duration of a test
+func withEnv(t *testing.T, key, value string) {
+	old, ok := os.LookupEnv(key)
+	os.Setenv(key, value)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+func TestLoadConfig(t *testing.T) {
+	expect := &Config{
+		Difficulty:        12,
+		ChallengeTTL:      Duration(30 * time.Second),
+		Scopes:            []string{"POST /login", "POST /signup"},
+		NonceHeader:       "X-Pow-Nonce",
+		NonceDataKey:      "n",
+		FailureStatusCode: 429,
+		Algorithm:         "scrypt",
+		AlgorithmParams:   "n=1024,r=8,p=1,l=32",
+		present: map[string]bool{
+			"difficulty": true, "challenge_ttl": true, "scopes": true, "nonce_header": true,
+			"nonce_data_key": true, "failure_status_code": true, "algorithm": true, "algorithm_params": true,
+		},
+	}
+
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"pow.yaml", `
+difficulty: 12
+challenge_ttl: 30s
+scopes: [POST /login, POST /signup]
+nonce_header: X-Pow-Nonce
+nonce_data_key: n
+failure_status_code: 429
+algorithm: scrypt
+algorithm_params: n=1024,r=8,p=1,l=32
+`},
+		{"pow.json", `{
+	"difficulty": 12,
+	"challenge_ttl": "30s",
+	"scopes": ["POST /login", "POST /signup"],
+	"nonce_header": "X-Pow-Nonce",
+	"nonce_data_key": "n",
+	"failure_status_code": 429,
+	"algorithm": "scrypt",
+	"algorithm_params": "n=1024,r=8,p=1,l=32"
+}`},
+	}
+
+	for _, f := range files {
+		t.Run(f.name, func(t *testing.T) {
+			cfg, err := LoadConfig(writeFile(t, f.name, f.content))
+			if err != nil {
+				t.Fatalf("LoadConfig() returned error: %v", err)
+			}
+
+			if !reflect.DeepEqual(cfg, expect) {
+				t.Errorf("LoadConfig(); Got: %+v, Expected: %+v", cfg, expect)
+			}
+		})
+	}
+
+	t.Run("environment", func(t *testing.T) {
+		withEnv(t, "GINPOW_CONFIG", writeFile(t, "pow.yaml", "difficulty: 12\ncheck: true\n"))
+		withEnv(t, "GINPOW_DIFFICULTY", "14")
+		withEnv(t, "GINPOW_CHECK", "false")
+		withEnv(t, "GINPOW_CHALLENGE_TTL", "5m")
+		withEnv(t, "GINPOW_SCOPES", "GET /a, GET /b")
+		withEnv(t, "GINPOW_MAX_BODY_SIZE", "1024")
+
+		cfg, err := LoadConfig("")
+		if err != nil {
+			t.Fatalf("LoadConfig() returned error: %v", err)
+		}
+
+		if cfg.Difficulty != 14 || cfg.Check || cfg.ChallengeTTL != Duration(5*time.Minute) || cfg.MaxBodySize != 1024 {
+			t.Errorf("environment does not take precedence: %+v", cfg)
+		}
+
+		if !reflect.DeepEqual(cfg.Scopes, []string{"GET /a", "GET /b"}) {
+			t.Errorf("scopes; Got: %q", cfg.Scopes)
+		}
+	})
+
+	t.Run("invalid environment", func(t *testing.T) {
+		withEnv(t, "GINPOW_DIFFICULTY", "hard")
+		withEnv(t, "GINPOW_CHALLENGE_TTL", "1 minute")
+
+		var configErr *ConfigError
+		if _, err := LoadConfig(""); !errors.As(err, &configErr) || len(configErr.Errors) != 2 {
+			t.Errorf("LoadConfig() did not return both errors: %v", err)
+		}
+	})
+
+	invalid := []struct {
+		name    string
+		content string
+	}{
+		{"unknown.yaml", "dificulty: 12\n"},
+		{"unknown.json", `{"dificulty": 12}`},
+		{"type.yaml", "difficulty: hard\n"},
+		{"pow.toml", "difficulty = 12\n"},
+	}
+
+	for _, f := range invalid {
+		t.Run(f.name, func(t *testing.T) {
+			if _, err := LoadConfig(writeFile(t, f.name, f.content)); err == nil {
+				t.Error("LoadConfig() did not error")
+			}
+		})
+	}
+}
+
+func TestConfig_Apply(t *testing.T) {
+	cfg := &Config{
+		Difficulty:      12,
+		ChallengeTTL:    Duration(time.Minute),
+		SecretFile:      writeFile(t, "secret", "0123456789abcdef\n"),
+		Algorithm:       "argon2id",
+		AlgorithmParams: "m=1024,t=1,p=1,l=32",
+		HashSource:      "query:hash",
+	}
+
+	pow := &Middleware{Difficulty: 8, NonceLength: 16}
+	if err := cfg.Apply(pow); err != nil {
+		t.Fatalf("Apply() returned error: %v", err)
+	}
+
+	if pow.Difficulty != 12 || pow.NonceLength != 16 || pow.ChallengeTTL != time.Minute || pow.HashSource != "query:hash" {
+		t.Errorf("config not applied: %+v", pow)
+	}
+
+	if !pow.Check || pow.Secret != "0123456789abcdef" {
+		t.Errorf("secret file not applied; Check: %v, Secret: %q", pow.Check, pow.Secret)
+	}
+
+	if pow.Algorithm == nil || pow.Algorithm.Params() != "m=1024,t=1,p=1,l=32" {
+		t.Errorf("algorithm not applied: %v", pow.Algorithm)
+	}
+
+	if _, err := New(pow); err != nil {
+		t.Errorf("New() returned error: %v", err)
+	}
+
+	invalid := []struct {
+		name string
+		cfg  *Config
+	}{
+		{"secret and secret file", &Config{Secret: "secret", SecretFile: cfg.SecretFile}},
+		{"missing secret file", &Config{SecretFile: filepath.Join(t.TempDir(), "missing")}},
+		{"unknown algorithm", &Config{Algorithm: "md5"}},
+		{"params without algorithm", &Config{AlgorithmParams: "n=1024"}},
+	}
+
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.cfg.Middleware(); err == nil {
+				t.Error("Middleware() did not error")
+			}
+		})
+	}
+
+	t.Run("explicit zero values", func(t *testing.T) {
+		withEnv(t, "GINPOW_CONFIG", writeFile(t, "pow.yaml", "report_only: false\nalgorithm: \"\"\n"))
+		withEnv(t, "GINPOW_CHECK", "false")
+		withEnv(t, "GINPOW_DIFFICULTY", "0")
+		withEnv(t, "GINPOW_ENFORCE_PERCENT", "0")
+
+		cfg, err := LoadConfig("")
+		if err != nil {
+			t.Fatalf("LoadConfig() returned error: %v", err)
+		}
+
+		pow := &Middleware{Check: true, Difficulty: 5, ReportOnly: true, EnforcePercent: 50, Algorithm: SHA256{}, NonceLength: 16}
+		if err := cfg.Apply(pow); err != nil {
+			t.Fatalf("Apply() returned error: %v", err)
+		}
+
+		if pow.Check || pow.Difficulty != 0 || pow.ReportOnly || pow.EnforcePercent != 0 || pow.Algorithm != nil {
+			t.Errorf("explicit zero values not applied: %+v", pow)
+		}
+
+		if pow.NonceLength != 16 {
+			t.Errorf("unset value applied; NonceLength: %v", pow.NonceLength)
+		}
+	})
+
+	t.Run("clearance ttl", func(t *testing.T) {
+		pow := &Middleware{Clearance: &Clearance{TTL: time.Minute, MaxUses: 5}}
+		if err := (&Config{ClearanceTTL: Duration(time.Hour)}).Apply(pow); err != nil {
+			t.Fatalf("Apply() returned error: %v", err)
+		}
+
+		if pow.Clearance.TTL != time.Hour || pow.Clearance.MaxUses != 5 {
+			t.Errorf("clearance ttl not applied: %+v", pow.Clearance)
+		}
+
+		withEnv(t, "GINPOW_CLEARANCE_TTL", "0s")
+		cfg, _ := LoadConfig("")
+		if err := cfg.Apply(pow); err != nil || pow.Clearance != nil {
+			t.Errorf("clearance not removed; Got: %+v %v", pow.Clearance, err)
+		}
+	})
+}
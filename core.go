@@ -0,0 +1,312 @@
+package ginpow
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrNonceSpent is the reason given when a nonce has already been used by a successful verification.
+var ErrNonceSpent = errors.New("nonce has already been spent")
+
+var (
+	// ErrMissingNonce is the error of a request without a nonce.
+	ErrMissingNonce = errors.New("no nonce in request")
+
+	// ErrMissingChecksum is the error of a request without a nonce checksum when `Middleware.Check` is true.
+	ErrMissingChecksum = errors.New("no nonce checksum in request")
+
+	// ErrMissingHash is the error of a request without a hash.
+	ErrMissingHash = errors.New("no hash in request")
+
+	// ErrBadHex is the error of a request with a hash or nonce checksum that is not a valid hex string.
+	ErrBadHex = errors.New("hash or nonce checksum is not a valid hex string")
+
+	// ErrChecksumMismatch is the error of a nonce checksum that was not issued for the nonce.
+	ErrChecksumMismatch = errors.New("nonce checksum does not match nonce")
+
+	// ErrHashMismatch is the error of a hash that is not the hash of the data and nonce.
+	ErrHashMismatch = errors.New("hash does not match data and nonce")
+
+	// ErrInsufficientDifficulty is the error of a hash without enough leading zeros for the difficulty.
+	ErrInsufficientDifficulty = errors.New("hash does not meet difficulty")
+)
+
+// reasonErrors are the errors of each failure reason
+var reasonErrors = map[string]error{
+	ReasonMissingNonce:           ErrMissingNonce,
+	ReasonMissingChecksum:        ErrMissingChecksum,
+	ReasonMissingHash:            ErrMissingHash,
+	ReasonBadHex:                 ErrBadHex,
+	ReasonChecksumMismatch:       ErrChecksumMismatch,
+	ReasonUnknownKey:             ErrUnknownKeyID,
+	ReasonHashMismatch:           ErrHashMismatch,
+	ReasonInsufficientDifficulty: ErrInsufficientDifficulty,
+	ReasonExpired:                ErrChallengeExpired,
+	ReasonNotYetValid:            ErrChallengeNotYetValid,
+	ReasonMalformed:              ErrChallengeMalformed,
+	ReasonSpent:                  ErrNonceSpent,
+	ReasonScopeMismatch:          ErrChallengeScopeMismatch,
+	ReasonBodyTooLarge:           ErrBodyTooLarge,
+	ReasonInvalidJSON:            ErrInvalidJSON,
+}
+
+// badRequestError is a bad request for a nonce, responded to with a 400
+type badRequestError struct {
+	code    string
+	message string
+}
+
+func (e badRequestError) Error() string {
+	return e.message
+}
+
+// extractError is an error returned by an extractor, responded to with a 500
+type extractError struct {
+	err error
+}
+
+func (e extractError) Error() string {
+	return e.err.Error()
+}
+
+// checkNonce returns a *VerificationError if the nonce or a required checksum is missing
+func (pow *Middleware) checkNonce(nonce, nonceChecksum string) error {
+	if nonce == "" {
+		return newVerificationError(ReasonMissingNonce, ErrMissingNonce.Error())
+	}
+
+	if pow.Check && nonceChecksum == "" {
+		err := newVerificationError(ReasonMissingChecksum, ErrMissingChecksum.Error())
+		err.Nonce = nonce
+		return err
+	}
+
+	return nil
+}
+
+// checkHash returns a *VerificationError if the hash is missing
+func checkHash(hash string) error {
+	if hash == "" {
+		return newVerificationError(ReasonMissingHash, ErrMissingHash.Error())
+	}
+	return nil
+}
+
+// verifyProof verifies a hash submitted by a client for a nonce and data, and returns
+// the result of the verification. It returns a *VerificationError if the proof is
+// malformed or fails verification, and any other error if the proof could not be checked.
+// scope is the scope of the route the proof is presented to and client is the key of
+// the client presenting it.
+func (pow *Middleware) verifyProof(nonce, nonceChecksum, data, hash, scope, client string) (*VerificationResult, error) {
+	ch, challengeErr := pow.verifyChallenge(nonce, scope)
+	difficulty := pow.challengeDifficulty(ch)
+
+	failure := func(code string, reason string) error {
+		err := newVerificationError(code, reason)
+		err.Hash = hash
+		err.Nonce = nonce
+		err.NonceChecksum = nonceChecksum
+		err.Difficulty = difficulty
+		return err
+	}
+
+	fail := func(code string, reason error) error {
+		if pow.Adaptive != nil {
+			pow.Adaptive.Observe(false)
+		}
+		return failure(code, reason.Error())
+	}
+
+	hashBytes, err := hex.DecodeString(hash)
+	if err != nil {
+		return nil, failure(ReasonBadHex, "received hash is not a valid hex string")
+	}
+
+	secret, checksum, keyErr := pow.verificationKey(nonceChecksum)
+	nonceChecksumBytes, err := hex.DecodeString(checksum)
+	if err != nil {
+		return nil, failure(ReasonBadHex, "received checksum is not a valid hex string")
+	}
+
+	if challengeErr != nil {
+		return nil, fail(challengeReason(challengeErr), challengeErr)
+	}
+
+	if keyErr != nil {
+		return nil, fail(ReasonUnknownKey, keyErr)
+	}
+
+	if reason := pow.mismatchReason(difficulty, nonce, nonceChecksumBytes, data, hashBytes, secret+client); reason != "" {
+		return nil, fail(reason, reasonErrors[reason])
+	}
+
+	if pow.NonceStore != nil {
+		fresh, err := pow.NonceStore.Spend(nonce)
+		if err != nil {
+			return nil, err
+		}
+
+		if !fresh {
+			return nil, fail(ReasonSpent, ErrNonceSpent)
+		}
+	}
+
+	if pow.Adaptive != nil {
+		pow.Adaptive.Observe(true)
+	}
+
+	res := &VerificationResult{
+		Passed:          true,
+		Nonce:           nonce,
+		Difficulty:      difficulty,
+		LeadingZeroBits: leadingZeroBits(hashBytes),
+		IssuedAt:        ch.issuedAt,
+	}
+	res.Algorithm, res.AlgorithmParams = pow.algorithmName()
+
+	if ch.hasScope {
+		res.Scope = ch.scope
+	}
+
+	if !ch.issuedAt.IsZero() {
+		res.SolveTime = timeNow().Sub(ch.issuedAt)
+	}
+
+	return res, nil
+}
+
+// rejection converts an error returned by a verification to a *VerificationError
+func rejection(err error) *VerificationError {
+	switch err := err.(type) {
+	case *VerificationError:
+		return err
+	case extractError:
+		for _, code := range []string{ReasonBodyTooLarge, ReasonInvalidJSON} {
+			if errors.Is(err.err, reasonErrors[code]) {
+				v := newVerificationError(code, err.Error())
+				v.Phase = PhaseExtract
+				return v
+			}
+		}
+		return internalError(PhaseExtract, err.err)
+	}
+	return internalError(PhaseVerify, err)
+}
+
+// malformed reports whether a verification failed because the proof is missing or malformed
+func (v *VerificationError) malformed() bool {
+	switch v.Code {
+	case ReasonMissingNonce, ReasonMissingChecksum, ReasonMissingHash, ReasonBadHex:
+		return true
+	}
+	return false
+}
+
+// failureStatus is the status code a failed verification is responded to with by default:
+// a 500 for an error, a 413 for a body that is too large, a 400 for an invalid JSON body
+// or a missing or malformed proof that isn't challenged, otherwise `FailureStatusCode`
+func (pow *Middleware) failureStatus(err *VerificationError) int {
+	switch err.Code {
+	case ReasonError:
+		return 500
+	case ReasonBodyTooLarge:
+		return 413
+	case ReasonInvalidJSON:
+		return 400
+	}
+
+	if err.malformed() && !pow.challenged(err) {
+		return 400
+	}
+	return pow.FailureStatusCode
+}
+
+// mismatchReason checks a proof against a nonce checksum computed with secret the same
+// way as gopow.Pow, cheapest check first so that each hash is computed at most once.
+// It returns the reason the proof fails, or an empty string if it passes.
+func (pow *Middleware) mismatchReason(difficulty int, nonce string, nonceChecksum []byte, data string, hash []byte, secret string) string {
+	if leadingZeroBits(hash) < difficulty {
+		return ReasonInsufficientDifficulty
+	}
+
+	if pow.Check && !bytes.Equal(pow.checksumHash([]byte(nonce+secret)), nonceChecksum) {
+		return ReasonChecksumMismatch
+	}
+
+	if !bytes.Equal(pow.proofHash([]byte(data+nonce)), hash) {
+		return ReasonHashMismatch
+	}
+
+	return ""
+}
+
+// challengeReason is the failure reason of an error returned by verifyChallenge
+func challengeReason(err error) string {
+	switch err {
+	case ErrChallengeExpired:
+		return ReasonExpired
+	case ErrChallengeNotYetValid:
+		return ReasonNotYetValid
+	case ErrChallengeScopeMismatch:
+		return ReasonScopeMismatch
+	}
+	return ReasonMalformed
+}
+
+// nonceData is the data returned by NonceHandler for a nonce
+func (pow *Middleware) nonceData(nonce, nonceChecksum string) gin.H {
+	ch := pow.issuedChallenge(nonce)
+
+	h := gin.H{
+		pow.NonceDataKey:          nonce,
+		pow.HashDifficultyDataKey: pow.challengeDifficulty(ch),
+	}
+
+	if pow.Check {
+		h[pow.NonceChecksumDataKey] = nonceChecksum
+	}
+
+	if pow.ChallengeTTL > 0 {
+		h[pow.NonceExpiresDataKey] = pow.expiresAt(ch).Unix()
+	}
+
+	if ch.hasScope {
+		h[pow.NonceScopeDataKey] = ch.scope
+	}
+
+	if pow.Algorithm != nil {
+		h[pow.HashAlgorithmDataKey] = pow.Algorithm.Name()
+		h[pow.HashParamsDataKey] = pow.Algorithm.Params()
+	}
+
+	return h
+}
+
+// setNonceHeaders sets the headers set by NonceHeaderMiddleware for a nonce
+func (pow *Middleware) setNonceHeaders(header http.Header, nonce, nonceChecksum string) {
+	ch := pow.issuedChallenge(nonce)
+
+	header.Set(pow.NonceHeader, nonce)
+	header.Set(pow.HashDifficultyHeader, strconv.Itoa(pow.challengeDifficulty(ch)))
+	if pow.Check {
+		header.Set(pow.NonceChecksumHeader, nonceChecksum)
+	}
+
+	if pow.ChallengeTTL > 0 {
+		header.Set(pow.NonceExpiresHeader, strconv.FormatInt(pow.expiresAt(ch).Unix(), 10))
+	}
+
+	if ch.hasScope {
+		header.Set(pow.NonceScopeHeader, ch.scope)
+	}
+
+	if pow.Algorithm != nil {
+		header.Set(pow.HashAlgorithmHeader, pow.Algorithm.Name())
+		header.Set(pow.HashParamsHeader, pow.Algorithm.Params())
+	}
+}
@@ -1,9 +1,7 @@
 package ginpow
 
 import (
-	"encoding/hex"
-	"errors"
-	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	gopow "github.com/jeongy-cho/go-pow/v2"
@@ -26,6 +24,26 @@ type Middleware struct {
 	//   Defaults to `X-Hash-Difficulty`
 	HashDifficultyHeader string
 
+	// NonceExpiresHeader is the name of the header on which to set the unix time a nonce expires.
+	//   Only set when `ChallengeTTL` is set. Defaults to `X-Nonce-Expires`
+	NonceExpiresHeader string
+
+	// HashAlgorithmHeader and HashParamsHeader are the names of the headers on which to set
+	//   the name and parameters of `Algorithm`. Only set when `Algorithm` is set.
+	//   Defaults to `X-Hash-Algorithm` and `X-Hash-Params`
+	HashAlgorithmHeader string
+	HashParamsHeader    string
+
+	// HashCounterHeader is the name of the header the default ExtractData reads the counter
+	//   of a proof from. See `ExtractBodyDigest`.
+	//   Defaults to `X-Hash-Counter`
+	HashCounterHeader string
+
+	// NonceScopeHeader is the name of the header on which to set the scope of a nonce, and on
+	//   which a client can request a scope. Only set when `Scopes` is set.
+	//   Defaults to `X-Nonce-Scope`
+	NonceScopeHeader string
+
 	// Pow is a gopow.Pow instance to handle proof of work implementation
 	Pow *gopow.Pow
 
@@ -37,21 +55,66 @@ type Middleware struct {
 
 	// ExtractData extracts the data that the hash was generated against and
 	//   passes it to do proof of work calculation.
-	//   Required when `ExtractAll` isn't defined.
+	//   Defaults to getting from `DataSource` if set, otherwise `ExtractBodyDigest`, which binds
+	//   proofs to the method, path and body of requests.
 	ExtractData func(c *gin.Context) (string, error)
 
+	// MaxBodySize is the most bytes of a request body the default ExtractData reads.
+	//   Defaults to DefaultMaxBodySize, 1 MiB.
+	MaxBodySize int64
+
 	// ExtractNonce extracts the nonce that is in the request.
-	//   Defaults getting from header X-Nonce, X-Nonce-Checksum
+	//   Defaults to getting from `NonceSource` and `NonceChecksumSource`.
 	ExtractNonce func(c *gin.Context) (nonce string, nonceChecksum string, error error)
 
 	// ExtractHash extracts the calculated hash calculated by the client.
-	//   Defaults to getting from header X-Hash.
+	//   Defaults to getting from `HashSource`.
 	ExtractHash func(c *gin.Context) (hash string, error error)
 
+	// NonceSource, NonceChecksumSource, HashSource and DataSource declare where the default
+	//   extractors read the proof from, as `kind:name` where kind is one of `header`, `query`,
+	//   `form`, `cookie` or `json`, e.g. `query:n`, `cookie:pow` or `json:$.proof.hash`.
+	//   Form and JSON bodies are left unread for the next handlers. Each is ignored when
+	//   the extractor it is read by is set.
+	//   Defaults to `header:` followed by `NonceHeader`, `NonceChecksumHeader` and `X-Hash`.
+	//   DataSource is optional, ExtractData defaults to `ExtractBodyDigest` without it.
+	NonceSource         string
+	NonceChecksumSource string
+	HashSource          string
+	DataSource          string
+
 	// Difficulty sets the number of leading zeros required for a valid hash.
 	//   Defaults to 0.
 	Difficulty int
 
+	// Adaptive adjusts the difficulty of issued nonces based on observed load,
+	//   starting from `Difficulty`. The difficulty a nonce was issued at is embedded
+	//   in it and verified against, so `Check` must be true. `ChallengeTTL` must be set
+	//   too, so that nonces issued at a low difficulty can't be spent once it is raised.
+	//   Optional. If not set then `Difficulty` is used for every nonce.
+	Adaptive *AdaptiveDifficulty
+
+	// DifficultyFunc chooses the difficulty of a nonce issued to a client, e.g. lower for
+	//   authenticated users and higher for suspicious ones. A negative value uses the
+	//   current difficulty and a value above the output size of the hash is capped to it.
+	//   The chosen difficulty is embedded in the nonce and verified against, so `Check`
+	//   must be true.
+	//   Optional.
+	DifficultyFunc func(c *gin.Context) int
+
+	// Scopes is the allowlist of scopes a client can request a nonce for, either a route
+	//   as `METHOD /route/template` or a named audience. When set, every nonce is bound
+	//   to a scope and VerifyNonceMiddleware rejects proofs whose scope does not match the
+	//   route they are presented to. A client requests a scope with the `NonceScopeHeader`
+	//   header or the `scope` query parameter, otherwise the scope of the issuing route is
+	//   used. The scope is embedded in the nonce, so `Check` must be true.
+	//   Optional.
+	Scopes []string
+
+	// ScopeFunc returns the scope of the route a request is made to.
+	//   Defaults to the request method and `c.FullPath()`, e.g. `POST /login`.
+	ScopeFunc func(c *gin.Context) string
+
 	// NonceLength sets the length of the nonce to be generated
 	//   Defaults to 10.
 	NonceLength int
@@ -64,6 +127,16 @@ type Middleware struct {
 	//   only used when `Check` flag is true. Defaults to 256 bit cryptographically secure string.
 	Secret string
 
+	// Keyring holds multiple secret keys so they can be rotated at runtime. Checksums are
+	//   prefixed with the id of the key they were computed with. Can't be set with `Secret`.
+	//   Optional. Only used when `Check` flag is true.
+	Keyring *Keyring
+
+	// ChallengeTTL is how long an issued nonce can be verified for. The issue time is
+	//   embedded in the nonce and covered by the nonce checksum, so it requires `Check`.
+	//   Defaults to 0, in which case nonces never expire.
+	ChallengeTTL time.Duration
+
 	// the following is the keys in which to set nonces in gin.Context.
 	// Defaults:
 	//   NonceContextKey:          "nonce"
@@ -73,32 +146,128 @@ type Middleware struct {
 	NonceChecksumContextKey  string
 	HashDifficultyContextKey string
 
+	// VerificationErrorContextKey is the key in which to set the *VerificationError of a
+	//   request that failed verification in gin.Context when it isn't enforced in
+	//   `ReportOnly` mode.
+	//   Defaults to `verificationError`
+	VerificationErrorContextKey string
+
 	// the following is the keys in which to set nonces in data of Middleware.NonceHandler.
 	// Defaults:
 	//   NonceDataKey:          "nonce"
 	//   NonceChecksumDataKey:  "nonce_checksum"
 	//   HashDifficultyDataKey: "difficulty"
+	//   NonceExpiresDataKey:   "expires"
+	//   HashAlgorithmDataKey:  "algorithm"
+	//   HashParamsDataKey:     "algorithm_params"
+	//   NonceScopeDataKey:     "scope"
 	NonceDataKey          string
 	NonceChecksumDataKey  string
 	HashDifficultyDataKey string
+	NonceExpiresDataKey   string
+	HashAlgorithmDataKey  string
+	HashParamsDataKey     string
+	NonceScopeDataKey     string
 
 	// FailureStatusCode is the status code to send back to client
 	//   when using default OnFailedVerification. defaults to 428.
 	FailureStatusCode int
 
-	// OnFailedVerification is called when a hash validation fails.
-	//   By default request Aborts and returns with `Middleware.FailureStatusCode`.
+	// OnFailedVerification is called whenever VerifyNonceMiddleware rejects a request: when
+	//   a hash validation fails, the proof is missing or malformed, or an error occurs, e.g.
+	//   in an extractor. `err.Phase` and `err.Code` tell these apart. It isn't called if an
+	//   extractor has already aborted the request. By default request Aborts and returns
+	//   with a 400 for a missing or malformed proof, a 500 for an error, and
+	//   `Middleware.FailureStatusCode` otherwise.
 	OnFailedVerification func(c *gin.Context, err *VerificationError)
 
+	// ProblemDetails responds to rejected requests with RFC 7807 problem details in
+	//   `application/problem+json`, or `application/problem+xml` depending on the accept
+	//   header, instead of plain text. See `Problem` for the members.
+	//   Defaults to false.
+	ProblemDetails bool
+
+	// NonceURL is the URL of a NonceHandler, linked to from problem details so clients
+	//   know where to get a new nonce.
+	//   Optional.
+	NonceURL string
+
+	// ReportOnly verifies requests without rejecting them, to measure how many clients
+	//   would be rejected before enforcing proof of work on an endpoint. A failed
+	//   verification is reported to `Metrics` as usual, set in the context under
+	//   `VerificationErrorContextKey` and passed to `OnReport` instead of
+	//   `OnFailedVerification`, and the request passes to the next handler.
+	//   Defaults to false.
+	ReportOnly bool
+
+	// EnforcePercent is the percentage of requests, from 0 to 100, whose failed verifications
+	//   are rejected in `ReportOnly` mode, so that enforcement can be ramped up gradually.
+	//   Requests are chosen at random.
+	//   Defaults to 0, in which case no request is rejected.
+	EnforcePercent int
+
+	// OnReport is called with a failed verification that isn't enforced in `ReportOnly` mode.
+	//   Optional.
+	OnReport func(c *gin.Context, err *VerificationError)
+
+	// OnIssue is called when a nonce is issued by NonceHandler, NonceHeaderMiddleware,
+	//   GenerateNonceMiddleware or for `ChallengeOnFailure`, e.g. to write an audit log.
+	//   Optional.
+	OnIssue func(c *gin.Context, ch *IssuedChallenge)
+
+	// OnVerified is called when VerifyNonceMiddleware verifies a proof, before the next handler.
+	//   Optional.
+	OnVerified func(c *gin.Context, res *VerificationResult)
+
+	// OnRejected is called when VerifyNonceMiddleware rejects a request, before
+	//   `OnFailedVerification` responds. It shouldn't respond itself.
+	//   Optional.
+	OnRejected func(c *gin.Context, err *VerificationError)
+
+	// ChallengeOnFailure responds to failed and missing proofs with a fresh nonce, so
+	//   clients can solve and retry in one round trip. The nonce is set in a
+	//   `WWW-Authenticate: PoW ...` header and in the context before `OnFailedVerification`
+	//   is called for failed or missing proofs. The default OnFailedVerification responds
+	//   with the nonce in JSON or XML like NonceHandler, with the failure `reason`.
+	//   Defaults to false.
+	ChallengeOnFailure bool
+
 	// Hash function for proof of work.
 	//   Defaults to sha256
 	Hash gopow.HashFunction
 
+	// Algorithm is a hash algorithm for proof of work that is advertised to clients,
+	//   e.g. the memory hard `Argon2id` or `Scrypt`. Can't be set with `Hash`. It is only
+	//   applied to proofs, nonce checksums are still computed with sha256.
+	//   Optional.
+	Algorithm HashAlgorithm
+
 	// NonceGenerator returns a nonce.
 	NonceGenerator gopow.NonceGenerator
+
+	// Metrics collects metrics on issued nonces and verifications.
+	//   Optional. See `Metrics` for a Collector with a Prometheus text exposition handler.
+	Metrics Collector
+
+	// NonceStore records nonces spent by successful verifications so they can't be replayed.
+	//   Optional. If not set then a solved nonce can be reused.
+	NonceStore NonceStore
+
+	// Binding binds nonces to the IP and headers of the client they are issued to, so
+	//   that a solved nonce can't be redeemed by another client. Requires `Check`.
+	//   Optional.
+	Binding *Binding
+
+	// Clearance issues a clearance token after a successful verification that is accepted
+	//   by VerifyClearanceMiddleware in lieu of a new proof. Requires `Check`.
+	//   Optional.
+	Clearance *Clearance
+
+	// hashSize is the size in bits of the output of the proof hash, set by configInit
+	hashSize int
 }
 
-// New sets the config of a middleware. ExtractData definition is required.
+// New sets the config of a middleware.
 func New(m *Middleware) (*Middleware, error) {
 	if err := m.middleWareInit(); err != nil {
 		return nil, err
@@ -107,10 +276,74 @@ func New(m *Middleware) (*Middleware, error) {
 }
 
 func (pow *Middleware) middleWareInit() error {
+	if err := pow.configInit(); err != nil {
+		return err
+	}
+
+	nonceSource, nonceChecksumSource, hashSource, dataSource, err := pow.sources()
+	if err != nil {
+		return err
+	}
+
 	if pow.ExtractData == nil && pow.ExtractAll == nil {
-		return errors.New("pow.ExtractData func not declared")
+		pow.ExtractData = pow.ExtractBodyDigest
+		if dataSource != nil {
+			pow.ExtractData = func(c *gin.Context) (string, error) {
+				return dataSource(c.Request)
+			}
+		}
+	}
+
+	if pow.ExtractNonce == nil {
+		pow.ExtractNonce = func(c *gin.Context) (nonce string, nonceChecksum string, err error) {
+			if nonce, err = nonceSource(c.Request); err != nil {
+				return "", "", err
+			}
+			nonceChecksum, err = nonceChecksumSource(c.Request)
+			return nonce, nonceChecksum, err
+		}
+	}
+
+	if pow.ExtractHash == nil {
+		pow.ExtractHash = func(c *gin.Context) (hash string, error error) {
+			return hashSource(c.Request)
+		}
+	}
+
+	if pow.ScopeFunc == nil {
+		pow.ScopeFunc = func(c *gin.Context) string {
+			return c.Request.Method + " " + c.FullPath()
+		}
+	}
+
+	if pow.OnFailedVerification == nil {
+		pow.OnFailedVerification = func(c *gin.Context, err *VerificationError) {
+			if pow.ProblemDetails {
+				pow.respondProblem(c, err)
+				return
+			}
+
+			if pow.challenged(err) {
+				pow.respondChallenge(c, err)
+				return
+			}
+
+			status := pow.failureStatus(err)
+			if status == 500 {
+				c.AbortWithStatus(500)
+				return
+			}
+
+			c.Abort()
+			c.String(status, err.Error())
+		}
 	}
 
+	return nil
+}
+
+// configInit sets the defaults of the config shared by the gin and net/http middlewares
+func (pow *Middleware) configInit() error {
 	if pow.NonceHeader == "" {
 		pow.NonceHeader = "X-Nonce"
 	}
@@ -123,19 +356,54 @@ func (pow *Middleware) middleWareInit() error {
 		pow.HashDifficultyHeader = "X-Hash-Difficulty"
 	}
 
-	if pow.ExtractNonce == nil {
-		pow.ExtractNonce = func(c *gin.Context) (nonce string, nonceChecksum string, err error) {
-			return c.GetHeader("X-Nonce"), c.GetHeader("X-Nonce-Checksum"), nil
-		}
+	if pow.NonceExpiresHeader == "" {
+		pow.NonceExpiresHeader = "X-Nonce-Expires"
 	}
 
-	if pow.ExtractHash == nil {
-		pow.ExtractHash = func(c *gin.Context) (hash string, error error) {
-			return c.GetHeader("X-Hash"), nil
+	if pow.HashAlgorithmHeader == "" {
+		pow.HashAlgorithmHeader = "X-Hash-Algorithm"
+	}
+
+	if pow.HashParamsHeader == "" {
+		pow.HashParamsHeader = "X-Hash-Params"
+	}
+
+	if pow.NonceScopeHeader == "" {
+		pow.NonceScopeHeader = "X-Nonce-Scope"
+	}
+
+	if pow.HashCounterHeader == "" {
+		pow.HashCounterHeader = "X-Hash-Counter"
+	}
+
+	if pow.NonceSource == "" {
+		pow.NonceSource = "header:" + pow.NonceHeader
+	}
+
+	if pow.NonceChecksumSource == "" {
+		pow.NonceChecksumSource = "header:" + pow.NonceChecksumHeader
+	}
+
+	if pow.HashSource == "" {
+		pow.HashSource = "header:X-Hash"
+	}
+
+	if pow.MaxBodySize == 0 {
+		pow.MaxBodySize = DefaultMaxBodySize
+	}
+
+	if errs := pow.conflicts(); len(errs) > 0 {
+		return errs[0]
+	}
+
+	if pow.Algorithm != nil {
+		if err := validateHashAlgorithm(pow.Algorithm); err != nil {
+			return err
 		}
 	}
+	pow.hashSize = pow.hashBits()
 
-	if pow.Check {
+	if pow.Check && pow.Keyring == nil {
 		if pow.Secret == "" {
 			var err error
 			pow.Secret, err = gonanoid.ID(32)
@@ -145,6 +413,30 @@ func (pow *Middleware) middleWareInit() error {
 		}
 	}
 
+	if pow.Adaptive != nil {
+		if err := pow.Adaptive.init(pow.Difficulty); err != nil {
+			return err
+		}
+	}
+
+	if pow.Binding != nil {
+		if err := pow.Binding.init(); err != nil {
+			return err
+		}
+	}
+
+	if pow.Clearance != nil {
+		if err := pow.Clearance.init(); err != nil {
+			return err
+		}
+	}
+
+	if metrics, ok := pow.Metrics.(*Metrics); ok {
+		if err := metrics.init(); err != nil {
+			return err
+		}
+	}
+
 	if pow.NonceLength == 0 {
 		pow.NonceLength = 10
 	}
@@ -170,6 +462,10 @@ func (pow *Middleware) middleWareInit() error {
 		pow.HashDifficultyContextKey = "hashDifficulty"
 	}
 
+	if pow.VerificationErrorContextKey == "" {
+		pow.VerificationErrorContextKey = "verificationError"
+	}
+
 	if pow.NonceDataKey == "" {
 		pow.NonceDataKey = "nonce"
 	}
@@ -182,38 +478,38 @@ func (pow *Middleware) middleWareInit() error {
 		pow.HashDifficultyDataKey = "difficulty"
 	}
 
-	if pow.FailureStatusCode == 0 {
-		pow.FailureStatusCode = 428
+	if pow.NonceExpiresDataKey == "" {
+		pow.NonceExpiresDataKey = "expires"
 	}
 
-	if pow.OnFailedVerification == nil {
-		pow.OnFailedVerification = func(c *gin.Context, err *VerificationError) {
-			c.Abort()
-			c.String(pow.FailureStatusCode, err.Error())
-		}
+	if pow.HashAlgorithmDataKey == "" {
+		pow.HashAlgorithmDataKey = "algorithm"
 	}
 
-	return nil
+	if pow.HashParamsDataKey == "" {
+		pow.HashParamsDataKey = "algorithm_params"
+	}
+
+	if pow.NonceScopeDataKey == "" {
+		pow.NonceScopeDataKey = "scope"
+	}
 
+	if pow.FailureStatusCode == 0 {
+		pow.FailureStatusCode = 428
+	}
+
+	return nil
 }
 
 // NonceHandler is the used by a client to get a nonce in JSON or XML depending on accept header
 func (pow *Middleware) NonceHandler(c *gin.Context) {
-	nonce, nonceChecksum, err := pow.getNonce(c)
+	nonce, nonceChecksum, err := pow.getNonce(c, SourceNonceHandler)
 	if err != nil {
-		c.Error(err)
+		pow.abortIssue(c, err)
 		return
 	}
 
-	var h gin.H
-	h = gin.H{
-		pow.NonceDataKey:          nonce,
-		pow.HashDifficultyDataKey: pow.Difficulty,
-	}
-
-	if pow.Check {
-		h[pow.NonceChecksumDataKey] = nonceChecksum
-	}
+	h := pow.nonceData(nonce, nonceChecksum)
 	c.Negotiate(200, gin.Negotiate{
 		Offered: []string{gin.MIMEJSON, gin.MIMEXML},
 		Data:    h,
@@ -222,39 +518,42 @@ func (pow *Middleware) NonceHandler(c *gin.Context) {
 
 // NonceHeaderMiddleware is used by a client to get a nonce embedded in the header of a request
 func (pow *Middleware) NonceHeaderMiddleware(c *gin.Context) {
-	nonce, nonceChecksum, err := pow.getNonce(c)
+	nonce, nonceChecksum, err := pow.getNonce(c, SourceNonceHeaderMiddleware)
 	if err != nil {
-		c.Error(err)
+		pow.abortIssue(c, err)
 		return
 	}
 
-	c.Header(pow.NonceHeader, nonce)
-	c.Header(pow.HashDifficultyHeader, strconv.Itoa(pow.Difficulty))
-	if pow.Check {
-		c.Header(pow.NonceChecksumHeader, nonceChecksum)
-	}
+	pow.setNonceHeaders(c.Writer.Header(), nonce, nonceChecksum)
 }
 
 // GenerateNonceMiddleware generates a nonce and sets it in the context.
 // if other ginpow middleware is used after this middleware then it will
 // use the nonce generated here.
 func (pow *Middleware) GenerateNonceMiddleware(c *gin.Context) {
-	nonce, nonceChecksum, err := pow.Pow.GenerateNonce()
+	scope, err := pow.issueScope(c)
+	if err != nil {
+		pow.abortIssue(c, err)
+		return
+	}
+
+	nonce, nonceChecksum, err := pow.generateNonce(pow.clientDifficulty(c), scope, pow.clientBinding(c.Request), SourceGenerateNonce)
 	if err != nil {
 		c.Error(err)
 		return
 	}
+	pow.onIssue(c, nonce, nonceChecksum, SourceGenerateNonce)
 
-	c.Set(pow.NonceContextKey, string(nonce))
-	c.Set(pow.HashDifficultyContextKey, pow.Difficulty)
+	c.Set(pow.NonceContextKey, nonce)
+	c.Set(pow.HashDifficultyContextKey, pow.challengeDifficulty(pow.issuedChallenge(nonce)))
 
 	if pow.Check {
-		c.Set(pow.NonceChecksumContextKey, hex.EncodeToString(nonceChecksum))
+		c.Set(pow.NonceChecksumContextKey, nonceChecksum)
 	}
 }
 
 // gets a nonce in context or generates one
-func (pow *Middleware) getNonce(c *gin.Context) (string, string, error) {
+func (pow *Middleware) getNonce(c *gin.Context, source string) (string, string, error) {
 
 	n, nExists := c.Get(pow.NonceContextKey)
 	nc, _ := c.Get(pow.NonceChecksumContextKey)
@@ -266,115 +565,194 @@ func (pow *Middleware) getNonce(c *gin.Context) (string, string, error) {
 		return n.(string), "", nil
 	}
 
-	nonce, nonceChecksum, err := pow.Pow.GenerateNonce()
-	return string(nonce), hex.EncodeToString(nonceChecksum), err
+	scope, err := pow.issueScope(c)
+	if err != nil {
+		return "", "", err
+	}
+
+	nonce, nonceChecksum, err := pow.generateNonce(pow.clientDifficulty(c), scope, pow.clientBinding(c.Request), source)
+	if err != nil {
+		return "", "", err
+	}
+
+	pow.onIssue(c, nonce, nonceChecksum, source)
+	return nonce, nonceChecksum, nil
 }
 
 // VerifyNonceMiddleware validates a hash given a nonce, data string, difficulty,
 // and, if `Middleware.Check == true`, nonce checksum. On failure, it will call
-// OnVerifiedFailed method. By default will Abort response with status code 428
+// OnVerifiedFailed method. By default will Abort response with status code 428.
+// On success, a clearance token is issued when `Middleware.Clearance` is set, and the
+// result of the verification is set in the context, see Result.
+// In `Middleware.ReportOnly` mode, failures that aren't enforced are reported instead.
 func (pow *Middleware) VerifyNonceMiddleware(c *gin.Context) {
-	var (
-		nonce         string
-		nonceChecksum string
-		data          string
-		hash          string
-		err           error
-	)
+	start := time.Now()
 
-	if pow.ExtractAll != nil {
-		nonce, nonceChecksum, data, hash, err = pow.ExtractAll(c)
-		if err != nil {
-			if !c.IsAborted() {
-				c.AbortWithError(500, err)
-			}
-			return
-		}
-	} else {
-		nonce, nonceChecksum, err = pow.ExtractNonce(c)
-		if err != nil {
-			if !c.IsAborted() {
-				c.AbortWithError(500, err)
-			}
-			return
-		}
+	res, err := pow.verifyContext(c)
+	pow.observeVerification(start, err)
 
-		if nonce == "" {
-			c.String(400, "no nonce in request")
-			c.Abort()
-			return
+	if err == nil && pow.Clearance != nil {
+		if clearanceErr := pow.setClearance(c.Writer.Header(), pow.routeScope(c), pow.clientBinding(c.Request)); clearanceErr != nil {
+			err = internalError(PhaseClearance, clearanceErr)
 		}
+	}
 
-		if pow.Check && nonceChecksum == "" {
-			c.String(400, "no nonce checksum in request")
-			c.Abort()
-			return
+	if err == nil {
+		res.VerifyTime = time.Since(start)
+		c.Set(resultContextKey, res)
+
+		if pow.OnVerified != nil {
+			pow.OnVerified(c, res)
 		}
+		return
+	}
 
-		data, err = pow.ExtractData(c)
-		if err != nil {
-			if !c.IsAborted() {
-				c.AbortWithError(500, err)
-			}
+	if _, ok := err.(extractError); ok && c.IsAborted() {
+		return
+	}
+
+	verificationErr := rejection(err)
+	if !pow.enforced() {
+		c.Set(resultContextKey, failedResult(start, verificationErr))
+		pow.report(c, verificationErr)
+		return
+	}
+
+	pow.failVerification(c, verificationErr)
+}
+
+// failVerification calls OnFailedVerification, after issuing a fresh nonce when the failure is challenged
+func (pow *Middleware) failVerification(c *gin.Context, err *VerificationError) {
+	c.Error(err)
+
+	if pow.OnRejected != nil {
+		pow.OnRejected(c, err)
+	}
+
+	if pow.challenged(err) {
+		if err := pow.setChallenge(c); err != nil {
+			pow.abortIssue(c, err)
 			return
 		}
+	}
+
+	pow.OnFailedVerification(c, err)
+}
 
-		hash, err = pow.ExtractHash(c)
+// verifyContext extracts a proof from a request and verifies it
+func (pow *Middleware) verifyContext(c *gin.Context) (*VerificationResult, error) {
+	if pow.ExtractAll != nil {
+		nonce, nonceChecksum, data, hash, err := pow.ExtractAll(c)
 		if err != nil {
-			if !c.IsAborted() {
-				c.AbortWithError(500, err)
-			}
-			return
+			return nil, extractError{err}
 		}
+		return pow.verifyProof(nonce, nonceChecksum, data, hash, pow.routeScope(c), pow.clientBinding(c.Request))
+	}
 
-		if hash == "" {
-			c.String(400, "no hash in request")
-			c.Abort()
-			return
-		}
+	nonce, nonceChecksum, err := pow.ExtractNonce(c)
+	if err != nil {
+		return nil, extractError{err}
+	}
+
+	if err := pow.checkNonce(nonce, nonceChecksum); err != nil {
+		return nil, err
 	}
-	hashBytes, err := hex.DecodeString(hash)
+
+	data, err := pow.ExtractData(c)
 	if err != nil {
-		c.String(400, "received hash is not a valid hex string")
-		c.Abort()
-		return
+		return nil, extractError{err}
 	}
 
-	nonceChecksumBytes, err := hex.DecodeString(nonceChecksum)
+	hash, err := pow.ExtractHash(c)
 	if err != nil {
-		c.String(400, "received checksum is not a valid hex string")
-		c.Abort()
-		return
+		return nil, extractError{err}
 	}
 
-	ok, verificationErr := pow.Pow.VerifyHashAtDifficulty([]byte(nonce), []byte(data), hashBytes, nonceChecksumBytes)
-	if !ok {
-		err := &VerificationError{
-			Hash:          hash,
-			Nonce:         nonce,
-			NonceChecksum: nonceChecksum,
-			Difficulty:    pow.Difficulty,
-			Reason:        verificationErr.Error(),
-		}
-		c.Error(err)
-		pow.OnFailedVerification(c, err)
+	if err := checkHash(hash); err != nil {
+		return nil, err
+	}
+
+	return pow.verifyProof(nonce, nonceChecksum, data, hash, pow.routeScope(c), pow.clientBinding(c.Request))
+}
+
+// clientDifficulty is the difficulty chosen by `DifficultyFunc`, or -1 if there is none
+func (pow *Middleware) clientDifficulty(c *gin.Context) int {
+	if pow.DifficultyFunc == nil {
+		return -1
 	}
+	return pow.DifficultyFunc(c)
 }
 
-// VerificationError reports the parameters that caused a verification to fail.
-// Does _not_ include data parameter.
+// the following are the phases of VerifyNonceMiddleware a request can be rejected in.
+const (
+	// PhaseExtract is extracting the proof from the request.
+	PhaseExtract = "extract"
+
+	// PhaseCheck is checking the proof is present and well formed.
+	PhaseCheck = "check"
+
+	// PhaseVerify is verifying the proof.
+	PhaseVerify = "verify"
+
+	// PhaseClearance is issuing a clearance token after a successful verification.
+	PhaseClearance = "clearance"
+)
+
+// VerificationError reports the parameters that caused a verification to fail, or
+// a request to be rejected. Does _not_ include data parameter.
 type VerificationError struct {
 	Hash          string
 	Nonce         string
 	NonceChecksum string
 	Difficulty    int
 	Reason        string
+
+	// Code is why the verification failed, one of the Reason constants, e.g. ReasonExpired.
+	//   It is ReasonError when the request could not be verified, e.g. an extractor failed.
+	Code string
+
+	// Phase is the phase the request was rejected in, one of the Phase constants.
+	Phase string
+
+	// Err is the error of Code, e.g. ErrChallengeExpired, so that failures can be told
+	//   apart with errors.Is. For ReasonError, it is the error that occurred.
+	Err error
+}
+
+// newVerificationError returns a *VerificationError for code with reason as its message
+func newVerificationError(code string, reason string) *VerificationError {
+	err := &VerificationError{
+		Reason: reason,
+		Code:   code,
+		Phase:  PhaseVerify,
+		Err:    reasonErrors[code],
+	}
+
+	if err.malformed() {
+		err.Phase = PhaseCheck
+	}
+	return err
+}
+
+// internalError returns a *VerificationError for an error that occurred in phase
+func internalError(phase string, err error) *VerificationError {
+	return &VerificationError{
+		Reason: err.Error(),
+		Code:   ReasonError,
+		Phase:  phase,
+		Err:    err,
+	}
 }
 
 func (v *VerificationError) Error() string {
 	return v.Reason
 }
 
+// Unwrap returns Err.
+func (v *VerificationError) Unwrap() error {
+	return v.Err
+}
+
 type headerGetter interface {
 	GetHeader(key string) string
 }
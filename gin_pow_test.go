@@ -10,6 +10,7 @@ import (
 	"net/http/httptest"
 	"reflect"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -26,29 +27,43 @@ func TestMain(m *testing.M) {
 
 func TestNew(t *testing.T) {
 	defaultMiddleware := &Middleware{
-		NonceHeader:              "X-Nonce",
-		NonceChecksumHeader:      "X-Nonce-Checksum",
-		HashDifficultyHeader:     "X-Hash-Difficulty",
-		Pow:                      &gopow.Pow{NonceLength: 10},
-		Difficulty:               0,
-		NonceLength:              10,
-		Check:                    false,
-		Secret:                   "",
-		NonceContextKey:          "nonce",
-		NonceChecksumContextKey:  "nonceChecksum",
-		HashDifficultyContextKey: "hashDifficulty",
-		NonceDataKey:             "nonce",
-		NonceChecksumDataKey:     "nonce_checksum",
-		HashDifficultyDataKey:    "difficulty",
-		FailureStatusCode:        428,
-		ExtractData:              func(c *gin.Context) (string, error) { return "d", nil },
+		NonceHeader:                 "X-Nonce",
+		NonceChecksumHeader:         "X-Nonce-Checksum",
+		HashDifficultyHeader:        "X-Hash-Difficulty",
+		NonceExpiresHeader:          "X-Nonce-Expires",
+		HashAlgorithmHeader:         "X-Hash-Algorithm",
+		HashParamsHeader:            "X-Hash-Params",
+		NonceScopeHeader:            "X-Nonce-Scope",
+		HashCounterHeader:           "X-Hash-Counter",
+		MaxBodySize:                 DefaultMaxBodySize,
+		NonceSource:                 "header:X-Nonce",
+		NonceChecksumSource:         "header:X-Nonce-Checksum",
+		HashSource:                  "header:X-Hash",
+		Pow:                         &gopow.Pow{NonceLength: 10},
+		Difficulty:                  0,
+		NonceLength:                 10,
+		Check:                       false,
+		Secret:                      "",
+		NonceContextKey:             "nonce",
+		NonceChecksumContextKey:     "nonceChecksum",
+		HashDifficultyContextKey:    "hashDifficulty",
+		VerificationErrorContextKey: "verificationError",
+		NonceDataKey:                "nonce",
+		NonceChecksumDataKey:        "nonce_checksum",
+		HashDifficultyDataKey:       "difficulty",
+		NonceExpiresDataKey:         "expires",
+		HashAlgorithmDataKey:        "algorithm",
+		HashParamsDataKey:           "algorithm_params",
+		NonceScopeDataKey:           "scope",
+		FailureStatusCode:           428,
+		ExtractData:                 func(c *gin.Context) (string, error) { return "d", nil },
 	}
 
 	t.Run("test defaults, no ExtractData", func(t *testing.T) {
-		_, err := New(&Middleware{})
+		m, err := New(&Middleware{})
 
-		if err == nil {
-			t.Error("New() did not error when ExtractData is not set")
+		if err != nil || m.ExtractData == nil {
+			t.Errorf("New() did not default ExtractData, error: %v", err)
 		}
 	})
 
@@ -80,6 +95,11 @@ func TestNew(t *testing.T) {
 				continue
 			}
 
+			// unexported fields are state computed from the config, not defaults
+			if e.Type().Field(i).PkgPath != "" {
+				continue
+			}
+
 			if varName == "Pow" {
 				continue
 			}
@@ -103,10 +123,14 @@ func TestNew(t *testing.T) {
 		e := reflect.ValueOf(newMiddleware).Elem()
 		funcNames := make(map[string]int, 0)
 		ignoreMethods := map[string]int{
-			"ExtractData":    1,
 			"Hash":           1,
 			"NonceGenerator": 1,
 			"ExtractAll":     1,
+			"DifficultyFunc": 1,
+			"OnReport":       1,
+			"OnIssue":        1,
+			"OnVerified":     1,
+			"OnRejected":     1,
 		}
 		// get all methods
 		for i := 0; i < e.NumField(); i++ {
@@ -174,6 +198,46 @@ func TestNew(t *testing.T) {
 			}
 		})
 
+		t.Run("default ScopeFunc", func(t *testing.T) {
+			newMiddleware, _ := New(&Middleware{
+				ExtractData: func(c *gin.Context) (string, error) { return "", nil },
+			})
+
+			w := httptest.NewRecorder()
+			_, r := gin.CreateTestContext(w)
+
+			var scope string
+			r.POST("/users/:id", func(c *gin.Context) { scope = newMiddleware.ScopeFunc(c) })
+			r.ServeHTTP(w, httptest.NewRequest("POST", "/users/1", nil))
+
+			if expect := "POST /users/:id"; scope != expect {
+				t.Errorf("default ScopeFunc; Got: %v, Expected: %v", scope, expect)
+			}
+
+			if !t.Failed() {
+				delete(funcNames, "ScopeFunc")
+			}
+		})
+
+		t.Run("default ExtractData", func(t *testing.T) {
+			newMiddleware, _ := New(&Middleware{})
+
+			req := httptest.NewRequest("POST", "/login?next=/", strings.NewReader("body"))
+			req.Header.Set("X-Hash-Counter", "42")
+
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = req
+
+			data, err := newMiddleware.ExtractData(c)
+			if expect := BodyDigest("POST", "/login", []byte("body")) + "42"; err != nil || data != expect {
+				t.Errorf("default ExtractData; Got: %v %v, Expected: %v", data, err, expect)
+			}
+
+			if !t.Failed() {
+				delete(funcNames, "ExtractData")
+			}
+		})
+
 		t.Run("default OnFailedVerification", func(t *testing.T) {
 			newMiddleware, _ := New(&Middleware{
 				ExtractData: func(c *gin.Context) (string, error) { return "", nil },
@@ -606,7 +670,7 @@ func TestMiddleware_getNonce(t *testing.T) {
 		n1, _ := c.Get(nonceKey)
 		nc1, _ := c.Get(nonceChecksumKey)
 
-		n2, nc2, _ := m.getNonce(c)
+		n2, nc2, _ := m.getNonce(c, SourceNonceHandler)
 
 		if !reflect.DeepEqual(n1, n2) {
 			t.Errorf("got different nonces; Got: %v, Expected: %v", n1, n2)
@@ -632,7 +696,7 @@ func TestMiddleware_getNonce(t *testing.T) {
 		m.GenerateNonceMiddleware(c)
 		n1, _ := c.Get(nonceKey)
 
-		n2, nc2, _ := m.getNonce(c)
+		n2, nc2, _ := m.getNonce(c, SourceNonceHandler)
 
 		if !reflect.DeepEqual(n1, n2) {
 			t.Errorf("got different nonces; Got: %v, Expected: %v", n1, n2)
@@ -724,6 +788,54 @@ func TestMiddleware_VerifyNonceMiddleware(t *testing.T) {
 			t.Errorf("verification failed with error: %v", c.Errors)
 		}
 	})
+	t.Run("replayed nonce", func(t *testing.T) {
+		var failed *VerificationError
+		m, _ := New(&Middleware{
+			Difficulty:  1,
+			Check:       true,
+			Secret:      "secret",
+			NonceStore:  NewMemoryNonceStore(0),
+			ExtractData: func(c *gin.Context) (string, error) { return "data11111", nil },
+			ExtractHash: func(c *gin.Context) (hash string, error error) {
+				hash = "024b6380e07b20023e1b986b250b09bcfaa4551510ac4903a9b052e2b2cf9019"
+				return
+			},
+			ExtractNonce: func(c *gin.Context) (nonce string, nonceChecksum string, error error) {
+				nonce = "nonce"
+				nonceChecksum = "5c420d7fedeb75e1309b1fe82f9c85d5552f1edfc11c72e7749330881166f18d"
+				return
+			},
+			OnFailedVerification: func(c *gin.Context, err *VerificationError) {
+				failed = err
+				c.AbortWithStatus(428)
+			},
+		})
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		m.VerifyNonceMiddleware(c)
+
+		if len(c.Errors) > 0 {
+			t.Errorf("first verification failed with error: %v", c.Errors)
+		}
+
+		w = httptest.NewRecorder()
+		c, _ = gin.CreateTestContext(w)
+		m.VerifyNonceMiddleware(c)
+
+		if failed == nil {
+			t.Fatal("replayed nonce did not fail verification")
+		}
+
+		if failed.Reason != ErrNonceSpent.Error() {
+			t.Errorf("unexpected reason; Got: %v, Expected: %v", failed.Reason, ErrNonceSpent)
+		}
+
+		if expect := 428; w.Code != expect {
+			t.Errorf("didn't return %v but %v", expect, w.Code)
+		}
+	})
+
 	t.Run("push error to error stack", func(t *testing.T) {
 		m, _ := New(&Middleware{
 			Difficulty:  1,
@@ -987,3 +1099,164 @@ func TestMiddleware_VerifyNonceMiddleware(t *testing.T) {
 	})
 
 }
+
+func TestVerificationError(t *testing.T) {
+	var failed *VerificationError
+	m, _ := New(&Middleware{
+		Check:       true,
+		Secret:      "secret",
+		Difficulty:  1,
+		ExtractData: func(c *gin.Context) (string, error) { return "data11111", nil },
+		OnFailedVerification: func(c *gin.Context, err *VerificationError) {
+			failed = err
+			c.AbortWithStatus(403)
+		},
+	})
+
+	tests := []struct {
+		name          string
+		nonce         string
+		nonceChecksum string
+		hash          string
+		code          string
+		phase         string
+		err           error
+	}{
+		{"missing nonce", "", "", "", ReasonMissingNonce, PhaseCheck, ErrMissingNonce},
+		{"missing checksum", "nonce", "", "", ReasonMissingChecksum, PhaseCheck, ErrMissingChecksum},
+		{"missing hash", "nonce", "00", "", ReasonMissingHash, PhaseCheck, ErrMissingHash},
+		{"bad hex", "nonce", "00", "not hex", ReasonBadHex, PhaseCheck, ErrBadHex},
+		{"checksum mismatch", "nonce", "00", "00", ReasonChecksumMismatch, PhaseVerify, ErrChecksumMismatch},
+		{"hash mismatch", "nonce", "5c420d7fedeb75e1309b1fe82f9c85d5552f1edfc11c72e7749330881166f18d", "00", ReasonHashMismatch, PhaseVerify, ErrHashMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failed = nil
+			m.ExtractNonce = func(c *gin.Context) (string, string, error) { return tt.nonce, tt.nonceChecksum, nil }
+			m.ExtractHash = func(c *gin.Context) (string, error) { return tt.hash, nil }
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			m.VerifyNonceMiddleware(c)
+
+			if failed == nil {
+				t.Fatalf("OnFailedVerification not called, responded with %v", w.Code)
+			}
+
+			if failed.Code != tt.code || failed.Phase != tt.phase {
+				t.Errorf("code, phase; Got: %v %v, Expected: %v %v", failed.Code, failed.Phase, tt.code, tt.phase)
+			}
+
+			if !errors.Is(failed, tt.err) {
+				t.Errorf("errors.Is(%v, %v) is false", failed, tt.err)
+			}
+
+			var verr *VerificationError
+			if !errors.As(c.Errors.Last().Err, &verr) || verr != failed {
+				t.Error("errors.As() did not find the *VerificationError set on the context")
+			}
+
+			if w.Code != 403 {
+				t.Errorf("OnFailedVerification response not sent, instead: %v", w.Code)
+			}
+		})
+	}
+
+	t.Run("insufficient difficulty", func(t *testing.T) {
+		m, _ := New(&Middleware{
+			Difficulty:  256,
+			ExtractData: func(c *gin.Context) (string, error) { return "data", nil },
+			ExtractNonce: func(c *gin.Context) (string, string, error) {
+				return "nonce", "", nil
+			},
+			ExtractHash: func(c *gin.Context) (string, error) {
+				sum := sha256.Sum256([]byte("datanonce"))
+				return hex.EncodeToString(sum[:]), nil
+			},
+		})
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		m.VerifyNonceMiddleware(c)
+
+		if !errors.Is(c.Errors.Last().Err, ErrInsufficientDifficulty) {
+			t.Errorf("unexpected error: %v", c.Errors)
+		}
+	})
+}
+
+func TestMiddleware_rejections(t *testing.T) {
+	extractErr := errors.New("extract failed")
+
+	t.Run("extractor error", func(t *testing.T) {
+		var failed *VerificationError
+		m, _ := New(&Middleware{
+			ExtractData: func(c *gin.Context) (string, error) { return "", extractErr },
+			ExtractNonce: func(c *gin.Context) (string, string, error) {
+				return "nonce", "", nil
+			},
+			OnFailedVerification: func(c *gin.Context, err *VerificationError) {
+				failed = err
+				c.AbortWithStatus(503)
+			},
+		})
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		m.VerifyNonceMiddleware(c)
+
+		if failed == nil {
+			t.Fatalf("OnFailedVerification not called, responded with %v", w.Code)
+		}
+
+		if failed.Code != ReasonError || failed.Phase != PhaseExtract || !errors.Is(failed, extractErr) {
+			t.Errorf("unexpected error: %+v", failed)
+		}
+
+		if w.Code != 503 {
+			t.Errorf("OnFailedVerification response not sent, instead: %v", w.Code)
+		}
+	})
+
+	t.Run("extractor aborted", func(t *testing.T) {
+		called := false
+		m, _ := New(&Middleware{
+			ExtractData: func(c *gin.Context) (string, error) { return "", nil },
+			ExtractNonce: func(c *gin.Context) (string, string, error) {
+				c.AbortWithStatus(401)
+				return "", "", extractErr
+			},
+			OnFailedVerification: func(c *gin.Context, err *VerificationError) { called = true },
+		})
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		m.VerifyNonceMiddleware(c)
+
+		if called || w.Code != 401 {
+			t.Errorf("response of extractor overridden; called: %v, code: %v", called, w.Code)
+		}
+	})
+
+	t.Run("default response to error", func(t *testing.T) {
+		m, _ := New(&Middleware{
+			ExtractData: func(c *gin.Context) (string, error) { return "", extractErr },
+			ExtractNonce: func(c *gin.Context) (string, string, error) {
+				return "nonce", "", nil
+			},
+		})
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		m.VerifyNonceMiddleware(c)
+
+		if w.Code != 500 || w.Body.Len() != 0 {
+			t.Errorf("unexpected response: %v %q", w.Code, w.Body.String())
+		}
+
+		if !errors.Is(c.Errors.Last().Err, extractErr) {
+			t.Errorf("error not set on context: %v", c.Errors)
+		}
+	})
+}
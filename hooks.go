@@ -0,0 +1,69 @@
+package ginpow
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IssuedChallenge is a nonce issued to a client, passed to `Middleware.OnIssue`.
+type IssuedChallenge struct {
+	Nonce         string
+	NonceChecksum string
+	Difficulty    int
+
+	// ExpiresAt is when the nonce expires, zero if `Middleware.ChallengeTTL` is not set.
+	ExpiresAt time.Time
+
+	// Algorithm and AlgorithmParams are the name and parameters of `Middleware.Algorithm`, if set.
+	Algorithm       string
+	AlgorithmParams string
+
+	// Scope is the scope the nonce is bound to, if any.
+	Scope string
+
+	// Source is where the nonce was issued from, one of the Source constants.
+	Source string
+}
+
+// issuedChallengeDetails returns the details of an issued nonce
+func (pow *Middleware) issuedChallengeDetails(nonce, nonceChecksum, source string) *IssuedChallenge {
+	ch := pow.issuedChallenge(nonce)
+
+	issued := &IssuedChallenge{
+		Nonce:         nonce,
+		NonceChecksum: nonceChecksum,
+		Difficulty:    pow.challengeDifficulty(ch),
+		Source:        source,
+	}
+
+	if pow.ChallengeTTL > 0 {
+		issued.ExpiresAt = pow.expiresAt(ch)
+	}
+
+	if pow.Algorithm != nil {
+		issued.Algorithm = pow.Algorithm.Name()
+		issued.AlgorithmParams = pow.Algorithm.Params()
+	}
+
+	if ch.hasScope {
+		issued.Scope = ch.scope
+	}
+
+	return issued
+}
+
+// onIssue calls OnIssue with an issued nonce
+func (pow *Middleware) onIssue(c *gin.Context, nonce, nonceChecksum, source string) {
+	if pow.OnIssue != nil {
+		pow.OnIssue(c, pow.issuedChallengeDetails(nonce, nonceChecksum, source))
+	}
+}
+
+// onIssue calls OnIssue with an issued nonce
+func (pow *HTTPMiddleware) onIssue(r *http.Request, nonce, nonceChecksum, source string) {
+	if pow.OnIssue != nil {
+		pow.OnIssue(r, pow.issuedChallengeDetails(nonce, nonceChecksum, source))
+	}
+}
@@ -0,0 +1,110 @@
+package ginpow
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMiddleware_hooks(t *testing.T) {
+	now := withTimeNow(t, time.Unix(1600000000, 0))
+
+	var issued []*IssuedChallenge
+	var verified *VerificationResult
+	var rejected *VerificationError
+
+	m, _ := New(&Middleware{
+		ExtractData:  func(c *gin.Context) (string, error) { return "", nil },
+		Check:        true,
+		Difficulty:   4,
+		ChallengeTTL: time.Minute,
+		Algorithm:    SHA256{},
+		OnIssue:      func(c *gin.Context, ch *IssuedChallenge) { issued = append(issued, ch) },
+		OnVerified:   func(c *gin.Context, res *VerificationResult) { verified = res },
+		OnRejected:   func(c *gin.Context, err *VerificationError) { rejected = err },
+	})
+
+	r := gin.New()
+	r.GET("/nonce", m.NonceHandler)
+	r.GET("/headers", m.NonceHeaderMiddleware)
+	r.GET("/generate", m.GenerateNonceMiddleware, m.NonceHandler)
+	r.GET("/verify", m.VerifyNonceMiddleware)
+
+	t.Run("OnIssue", func(t *testing.T) {
+		for _, path := range []string{"/nonce", "/headers", "/generate"} {
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+		}
+
+		if len(issued) != 3 {
+			t.Fatalf("OnIssue called %v times, expected 3", len(issued))
+		}
+
+		for i, source := range []string{SourceNonceHandler, SourceNonceHeaderMiddleware, SourceGenerateNonce} {
+			if issued[i].Source != source {
+				t.Errorf("source; Got: %v, Expected: %v", issued[i].Source, source)
+			}
+		}
+
+		ch := issued[0]
+		if ch.Nonce == "" || ch.NonceChecksum == "" || ch.Difficulty != 4 || ch.Algorithm != "sha256" ||
+			!ch.ExpiresAt.Equal(now.Add(time.Minute)) {
+			t.Errorf("unexpected challenge: %+v", ch)
+		}
+	})
+
+	t.Run("OnVerified", func(t *testing.T) {
+		ch := issued[0]
+		data, hash := solve("data", ch.Nonce, 4)
+		m.ExtractData = func(c *gin.Context) (string, error) { return data, nil }
+		m.ExtractNonce = func(c *gin.Context) (string, string, error) { return ch.Nonce, ch.NonceChecksum, nil }
+		m.ExtractHash = func(c *gin.Context) (string, error) { return hash, nil }
+
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/verify", nil))
+
+		if verified == nil || verified.Nonce != ch.Nonce || rejected != nil {
+			t.Errorf("OnVerified not called; verified: %+v, rejected: %v", verified, rejected)
+		}
+	})
+
+	t.Run("OnRejected", func(t *testing.T) {
+		verified = nil
+		m.ExtractHash = func(c *gin.Context) (string, error) { return "00", nil }
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/verify", nil))
+
+		if rejected == nil || rejected.Code != ReasonHashMismatch || verified != nil {
+			t.Errorf("OnRejected not called; verified: %+v, rejected: %v", verified, rejected)
+		}
+
+		if w.Code != 428 {
+			t.Errorf("OnFailedVerification not called after OnRejected, responded with %v", w.Code)
+		}
+	})
+}
+
+func TestHTTPMiddleware_hooks(t *testing.T) {
+	var issued *IssuedChallenge
+	var rejected *VerificationError
+
+	m, _ := NewHTTP(&HTTPMiddleware{
+		Middleware:  &Middleware{ChallengeOnFailure: true},
+		ExtractData: func(r *http.Request) (string, error) { return "data", nil },
+		OnIssue:     func(r *http.Request, ch *IssuedChallenge) { issued = ch },
+		OnRejected:  func(r *http.Request, err *VerificationError) { rejected = err },
+	})
+
+	w := httptest.NewRecorder()
+	m.VerifyNonceMiddleware(http.NotFoundHandler()).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	if rejected == nil || rejected.Code != ReasonMissingNonce {
+		t.Errorf("OnRejected not called: %v", rejected)
+	}
+
+	if issued == nil || issued.Source != SourceChallenge {
+		t.Errorf("OnIssue not called for challenge: %+v", issued)
+	}
+}
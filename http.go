@@ -0,0 +1,410 @@
+package ginpow
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+)
+
+// HTTPMiddleware adapts a Middleware to net/http. It uses the config of the embedded
+// Middleware, with net/http versions of its callbacks, and responds the same way
+// as the gin handlers. The gin callbacks of the embedded Middleware are shadowed by
+// these, so NewHTTP rejects an embedded Middleware with any of them set.
+type HTTPMiddleware struct {
+	*Middleware
+
+	// ExtractAll extracts all necessary data at once.
+	//   Optional. When ExtractAll is set, then `ExtractData`, `ExtractNonce`, `ExtractHash` is ignored.
+	ExtractAll func(r *http.Request) (nonce string, nonceChecksum string, data string, hash string, err error)
+
+	// ExtractData extracts the data that the hash was generated against.
+	//   Defaults to getting from `Middleware.DataSource` if set, otherwise `ExtractBodyDigest`.
+	ExtractData func(r *http.Request) (string, error)
+
+	// ExtractNonce extracts the nonce that is in the request.
+	//   Defaults to getting from `Middleware.NonceSource` and `Middleware.NonceChecksumSource`.
+	ExtractNonce func(r *http.Request) (nonce string, nonceChecksum string, err error)
+
+	// ExtractHash extracts the calculated hash calculated by the client.
+	//   Defaults to getting from `Middleware.HashSource`.
+	ExtractHash func(r *http.Request) (hash string, err error)
+
+	// DifficultyFunc chooses the difficulty of a nonce issued to a client.
+	//   See `Middleware.DifficultyFunc`. NewHTTP adapts it to the embedded Middleware so
+	//   that nonces without an embedded difficulty are rejected. Optional.
+	DifficultyFunc func(r *http.Request) int
+
+	// ScopeFunc returns the scope of the route a request is made to. See `Middleware.Scopes`.
+	//   Defaults to the request method and path, e.g. `POST /login`.
+	ScopeFunc func(r *http.Request) string
+
+	// OnFailedVerification is called whenever VerifyNonceMiddleware rejects a request.
+	//   See `Middleware.OnFailedVerification`. By default responds with a 400 for a missing
+	//   or malformed proof, a 500 for an error, and `Middleware.FailureStatusCode` otherwise.
+	//   The next handler is never called after a failed verification.
+	OnFailedVerification func(w http.ResponseWriter, r *http.Request, err *VerificationError)
+
+	// OnReport is called with a failed verification that isn't enforced in
+	//   `Middleware.ReportOnly` mode. Optional.
+	OnReport func(r *http.Request, err *VerificationError)
+
+	// OnIssue, OnVerified and OnRejected are called when a nonce is issued, a proof is
+	//   verified and a request is rejected. See `Middleware.OnIssue`. Optional.
+	OnIssue    func(r *http.Request, ch *IssuedChallenge)
+	OnVerified func(r *http.Request, res *VerificationResult)
+	OnRejected func(r *http.Request, err *VerificationError)
+}
+
+// contextKey is the type of the keys nonces are stored under in a request context
+type contextKey string
+
+// NewHTTP sets the config of a net/http middleware.
+func NewHTTP(m *HTTPMiddleware) (*HTTPMiddleware, error) {
+	if m.Middleware == nil {
+		m.Middleware = &Middleware{}
+	}
+
+	if name := m.Middleware.shadowedCallback(); name != "" {
+		return nil, fmt.Errorf("pow.Middleware.%v is not used by HTTPMiddleware, set HTTPMiddleware.%v instead", name, name)
+	}
+
+	// bridged before configInit, which checks that it is used with Check
+	if m.DifficultyFunc != nil {
+		m.Middleware.DifficultyFunc = func(c *gin.Context) int {
+			return m.DifficultyFunc(c.Request)
+		}
+	}
+
+	if err := m.Middleware.configInit(); err != nil {
+		return nil, err
+	}
+
+	nonceSource, nonceChecksumSource, hashSource, dataSource, err := m.sources()
+	if err != nil {
+		return nil, err
+	}
+
+	if m.ExtractData == nil && m.ExtractAll == nil {
+		m.ExtractData = m.ExtractBodyDigest
+		if dataSource != nil {
+			m.ExtractData = dataSource
+		}
+	}
+
+	if m.ExtractNonce == nil {
+		m.ExtractNonce = func(r *http.Request) (nonce string, nonceChecksum string, err error) {
+			if nonce, err = nonceSource(r); err != nil {
+				return "", "", err
+			}
+			nonceChecksum, err = nonceChecksumSource(r)
+			return nonce, nonceChecksum, err
+		}
+	}
+
+	if m.ExtractHash == nil {
+		m.ExtractHash = hashSource
+	}
+
+	if m.ScopeFunc == nil {
+		m.ScopeFunc = func(r *http.Request) string {
+			return r.Method + " " + r.URL.Path
+		}
+	}
+
+	if m.OnFailedVerification == nil {
+		m.OnFailedVerification = func(w http.ResponseWriter, r *http.Request, err *VerificationError) {
+			if m.ProblemDetails {
+				m.respondProblem(w, r, err)
+				return
+			}
+
+			if m.challenged(err) {
+				m.respondChallenge(w, r, err)
+				return
+			}
+
+			status := m.failureStatus(err)
+			if status == 500 {
+				w.WriteHeader(500)
+				return
+			}
+
+			writeString(w, status, err.Error())
+		}
+	}
+
+	return m, nil
+}
+
+// shadowedCallback returns the name of the first gin callback that is set, which
+// HTTPMiddleware would ignore, or an empty string if there is none
+func (pow *Middleware) shadowedCallback() string {
+	callbacks := []struct {
+		name string
+		set  bool
+	}{
+		{"ExtractAll", pow.ExtractAll != nil},
+		{"ExtractData", pow.ExtractData != nil},
+		{"ExtractNonce", pow.ExtractNonce != nil},
+		{"ExtractHash", pow.ExtractHash != nil},
+		{"DifficultyFunc", pow.DifficultyFunc != nil},
+		{"OnFailedVerification", pow.OnFailedVerification != nil},
+		{"OnReport", pow.OnReport != nil},
+		{"OnIssue", pow.OnIssue != nil},
+		{"OnVerified", pow.OnVerified != nil},
+		{"OnRejected", pow.OnRejected != nil},
+	}
+
+	for _, cb := range callbacks {
+		if cb.set {
+			return cb.name
+		}
+	}
+	return ""
+}
+
+// NonceHandler is the used by a client to get a nonce in JSON or XML depending on accept header
+func (pow *HTTPMiddleware) NonceHandler(w http.ResponseWriter, r *http.Request) {
+	nonce, nonceChecksum, err := pow.getNonce(r, SourceNonceHandler)
+	if err != nil {
+		pow.writeError(w, r, err)
+		return
+	}
+
+	h := pow.nonceData(nonce, nonceChecksum)
+
+	var rd render.Render
+	switch negotiateFormat(r, gin.MIMEJSON, gin.MIMEXML) {
+	case gin.MIMEJSON:
+		rd = render.JSON{Data: h}
+	case gin.MIMEXML:
+		rd = render.XML{Data: h}
+	default:
+		w.WriteHeader(http.StatusNotAcceptable)
+		return
+	}
+
+	rd.WriteContentType(w)
+	w.WriteHeader(200)
+	rd.Render(w)
+}
+
+// NonceHeaderMiddleware sets a nonce in the headers of the response of the next handler
+func (pow *HTTPMiddleware) NonceHeaderMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce, nonceChecksum, err := pow.getNonce(r, SourceNonceHeaderMiddleware)
+		if err != nil {
+			pow.writeError(w, r, err)
+			return
+		}
+
+		pow.setNonceHeaders(w.Header(), nonce, nonceChecksum)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// GenerateNonceMiddleware generates a nonce and sets it in the request context.
+// if other ginpow middleware is used after this middleware then it will
+// use the nonce generated here.
+func (pow *HTTPMiddleware) GenerateNonceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scope, err := pow.issueScope(r)
+		if err != nil {
+			pow.writeError(w, r, err)
+			return
+		}
+
+		nonce, nonceChecksum, err := pow.generateNonce(pow.clientDifficulty(r), scope, pow.clientBinding(r), SourceGenerateNonce)
+		if err != nil {
+			pow.writeError(w, r, err)
+			return
+		}
+		pow.onIssue(r, nonce, nonceChecksum, SourceGenerateNonce)
+
+		ctx := context.WithValue(r.Context(), contextKey(pow.NonceContextKey), nonce)
+		ctx = context.WithValue(ctx, contextKey(pow.HashDifficultyContextKey), pow.challengeDifficulty(pow.issuedChallenge(nonce)))
+		if pow.Check {
+			ctx = context.WithValue(ctx, contextKey(pow.NonceChecksumContextKey), nonceChecksum)
+		}
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// NonceFromContext returns the nonce set in a request context by GenerateNonceMiddleware.
+func (pow *HTTPMiddleware) NonceFromContext(ctx context.Context) (nonce string, nonceChecksum string, difficulty int, ok bool) {
+	nonce, ok = ctx.Value(contextKey(pow.NonceContextKey)).(string)
+	nonceChecksum, _ = ctx.Value(contextKey(pow.NonceChecksumContextKey)).(string)
+	difficulty, _ = ctx.Value(contextKey(pow.HashDifficultyContextKey)).(int)
+	return
+}
+
+// gets a nonce in context or generates one
+func (pow *HTTPMiddleware) getNonce(r *http.Request, source string) (string, string, error) {
+	if nonce, nonceChecksum, _, ok := pow.NonceFromContext(r.Context()); ok {
+		if pow.Check {
+			return nonce, nonceChecksum, nil
+		}
+		return nonce, "", nil
+	}
+
+	scope, err := pow.issueScope(r)
+	if err != nil {
+		return "", "", err
+	}
+
+	nonce, nonceChecksum, err := pow.generateNonce(pow.clientDifficulty(r), scope, pow.clientBinding(r), source)
+	if err != nil {
+		return "", "", err
+	}
+
+	pow.onIssue(r, nonce, nonceChecksum, source)
+	return nonce, nonceChecksum, nil
+}
+
+// VerifyNonceMiddleware validates a hash given a nonce, data string, difficulty,
+// and, if `Middleware.Check == true`, nonce checksum before calling the next handler.
+// On failure, it will call OnFailedVerification. By default responds with status code 428.
+// On success, a clearance token is issued when `Middleware.Clearance` is set, and the
+// result of the verification is set in the request context, see ResultFromContext.
+// In `Middleware.ReportOnly` mode, failures that aren't enforced are reported instead.
+func (pow *HTTPMiddleware) VerifyNonceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		res, err := pow.verifyRequest(r)
+		pow.observeVerification(start, err)
+
+		if err == nil && pow.Clearance != nil {
+			if clearanceErr := pow.setClearance(w.Header(), pow.routeScope(r), pow.clientBinding(r)); clearanceErr != nil {
+				err = internalError(PhaseClearance, clearanceErr)
+			}
+		}
+
+		if err == nil {
+			res.VerifyTime = time.Since(start)
+			r = r.WithContext(withResult(r.Context(), res))
+
+			if pow.OnVerified != nil {
+				pow.OnVerified(r, res)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		verificationErr := rejection(err)
+		if !pow.enforced() {
+			r = r.WithContext(withResult(r.Context(), failedResult(start, verificationErr)))
+			next.ServeHTTP(w, pow.report(r, verificationErr))
+			return
+		}
+
+		pow.failVerification(w, r, verificationErr)
+	})
+}
+
+// failVerification calls OnFailedVerification, after issuing a fresh nonce when the failure is challenged
+func (pow *HTTPMiddleware) failVerification(w http.ResponseWriter, r *http.Request, err *VerificationError) {
+	if pow.OnRejected != nil {
+		pow.OnRejected(r, err)
+	}
+
+	if pow.challenged(err) {
+		var issueErr error
+		if r, issueErr = pow.setChallenge(w, r); issueErr != nil {
+			pow.writeError(w, r, issueErr)
+			return
+		}
+	}
+
+	pow.OnFailedVerification(w, r, err)
+}
+
+// verifyRequest extracts a proof from a request and verifies it
+func (pow *HTTPMiddleware) verifyRequest(r *http.Request) (*VerificationResult, error) {
+	if pow.ExtractAll != nil {
+		nonce, nonceChecksum, data, hash, err := pow.ExtractAll(r)
+		if err != nil {
+			return nil, extractError{err}
+		}
+		return pow.verifyProof(nonce, nonceChecksum, data, hash, pow.routeScope(r), pow.clientBinding(r))
+	}
+
+	nonce, nonceChecksum, err := pow.ExtractNonce(r)
+	if err != nil {
+		return nil, extractError{err}
+	}
+
+	if err := pow.checkNonce(nonce, nonceChecksum); err != nil {
+		return nil, err
+	}
+
+	data, err := pow.ExtractData(r)
+	if err != nil {
+		return nil, extractError{err}
+	}
+
+	hash, err := pow.ExtractHash(r)
+	if err != nil {
+		return nil, extractError{err}
+	}
+
+	if err := checkHash(hash); err != nil {
+		return nil, err
+	}
+
+	return pow.verifyProof(nonce, nonceChecksum, data, hash, pow.routeScope(r), pow.clientBinding(r))
+}
+
+// clientDifficulty is the difficulty chosen by `DifficultyFunc`, or -1 if there is none
+func (pow *HTTPMiddleware) clientDifficulty(r *http.Request) int {
+	if pow.DifficultyFunc == nil {
+		return -1
+	}
+	return pow.DifficultyFunc(r)
+}
+
+// writeString responds with a plain text body like gin.Context.String
+func writeString(w http.ResponseWriter, code int, s string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(code)
+	w.Write([]byte(s))
+}
+
+// negotiateFormat returns the first offered mime type accepted by the request like
+// gin.Context.NegotiateFormat, or "" if none are accepted
+func negotiateFormat(r *http.Request, offered ...string) string {
+	var accepted []string
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		if part = strings.TrimSpace(strings.Split(part, ";")[0]); part != "" {
+			accepted = append(accepted, part)
+		}
+	}
+
+	if len(accepted) == 0 {
+		return offered[0]
+	}
+
+	for _, a := range accepted {
+		for _, offer := range offered {
+			i := 0
+			for ; i < len(a) && i < len(offer); i++ {
+				if a[i] == '*' || offer[i] == '*' {
+					return offer
+				}
+				if a[i] != offer[i] {
+					break
+				}
+			}
+			if i == len(a) && i == len(offer) {
+				return offer
+			}
+		}
+	}
+	return ""
+}
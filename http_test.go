@@ -0,0 +1,249 @@
+package ginpow
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNewHTTP(t *testing.T) {
+	t.Run("no ExtractData", func(t *testing.T) {
+		m, err := NewHTTP(&HTTPMiddleware{})
+
+		if err != nil || m.ExtractData == nil {
+			t.Errorf("NewHTTP() did not default ExtractData, error: %v", err)
+		}
+	})
+
+	t.Run("defaults", func(t *testing.T) {
+		m, err := NewHTTP(&HTTPMiddleware{
+			ExtractData: func(r *http.Request) (string, error) { return "", nil },
+		})
+		if err != nil {
+			t.Fatalf("NewHTTP() returned error: %v", err)
+		}
+
+		if m.NonceHeader != "X-Nonce" || m.FailureStatusCode != 428 || m.Pow == nil {
+			t.Error("shared config defaults not set")
+		}
+
+		if m.ExtractNonce == nil || m.ExtractHash == nil || m.OnFailedVerification == nil {
+			t.Error("default methods not set")
+		}
+	})
+
+	t.Run("shadowed callback", func(t *testing.T) {
+		_, err := NewHTTP(&HTTPMiddleware{
+			Middleware: &Middleware{OnRejected: func(c *gin.Context, err *VerificationError) {}},
+		})
+
+		if err == nil || !strings.Contains(err.Error(), "OnRejected") {
+			t.Errorf("NewHTTP() did not reject a shadowed callback, error: %v", err)
+		}
+	})
+
+	t.Run("DifficultyFunc requires check", func(t *testing.T) {
+		m := &HTTPMiddleware{DifficultyFunc: func(r *http.Request) int { return -1 }}
+
+		if _, err := NewHTTP(m); err == nil || !strings.Contains(err.Error(), "pow.DifficultyFunc requires pow.Check") {
+			t.Errorf("NewHTTP() did not reject DifficultyFunc without Check, error: %v", err)
+		}
+
+		if m.Secret != "" {
+			t.Error("secret generated for a rejected config")
+		}
+	})
+
+	t.Run("DifficultyFunc", func(t *testing.T) {
+		m, err := NewHTTP(&HTTPMiddleware{
+			Middleware:     &Middleware{Check: true, Difficulty: 4},
+			DifficultyFunc: func(r *http.Request) int { return -1 },
+		})
+		if err != nil {
+			t.Fatalf("NewHTTP() returned error: %v", err)
+		}
+
+		nonce, _, _ := m.getNonce(httptest.NewRequest("GET", "/", nil), SourceNonceHandler)
+		if !strings.HasSuffix(nonce, ".d4") {
+			t.Errorf("difficulty not embedded in nonce: %v", nonce)
+		}
+
+		if _, err := m.verifyChallenge("random", ""); err != ErrChallengeMalformed {
+			t.Errorf("verifyChallenge() = %v, want %v", err, ErrChallengeMalformed)
+		}
+	})
+}
+
+func TestHTTPMiddleware_NonceHandler(t *testing.T) {
+	m, _ := NewHTTP(&HTTPMiddleware{
+		Middleware:  &Middleware{Check: true, Difficulty: 3},
+		ExtractData: func(r *http.Request) (string, error) { return "", nil },
+	})
+
+	t.Run("json", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		m.NonceHandler(w, httptest.NewRequest("GET", "/", nil))
+
+		var j map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &j)
+
+		if w.Code != 200 {
+			t.Errorf("unexpected status: %v", w.Code)
+		}
+
+		if _, ok := j["nonce"]; !ok {
+			t.Error("nonce not returned")
+		}
+
+		if _, ok := j["nonce_checksum"]; !ok {
+			t.Error("nonce_checksum not returned")
+		}
+
+		if j["difficulty"] != float64(3) {
+			t.Errorf("unexpected difficulty: %v", j["difficulty"])
+		}
+	})
+
+	t.Run("xml", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", "application/xml")
+		w := httptest.NewRecorder()
+		m.NonceHandler(w, r)
+
+		var x struct {
+			Nonce      string `xml:"nonce"`
+			Difficulty int    `xml:"difficulty"`
+		}
+		if err := xml.Unmarshal(w.Body.Bytes(), &x); err != nil {
+			t.Fatalf("could not decode xml: %v", err)
+		}
+
+		if x.Nonce == "" || x.Difficulty != 3 {
+			t.Errorf("unexpected xml: %s", w.Body.String())
+		}
+	})
+
+	t.Run("not acceptable", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", "text/html")
+		w := httptest.NewRecorder()
+		m.NonceHandler(w, r)
+
+		if expect := http.StatusNotAcceptable; w.Code != expect {
+			t.Errorf("didn't return %v but %v", expect, w.Code)
+		}
+	})
+}
+
+func TestHTTPMiddleware_NonceHeaderMiddleware(t *testing.T) {
+	m, _ := NewHTTP(&HTTPMiddleware{
+		Middleware:  &Middleware{Check: true},
+		ExtractData: func(r *http.Request) (string, error) { return "", nil },
+	})
+
+	var generated string
+	h := m.GenerateNonceMiddleware(m.NonceHeaderMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		generated, _, _, _ = m.NonceFromContext(r.Context())
+	})))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	if generated == "" {
+		t.Error("nonce not set in context")
+	}
+
+	if got := w.Result().Header.Get("X-Nonce"); got != generated {
+		t.Errorf("header nonce is not the generated nonce; Got: %v, Expected: %v", got, generated)
+	}
+
+	if w.Result().Header.Get("X-Nonce-Checksum") == "" {
+		t.Error("no X-Nonce-Checksum")
+	}
+
+	if w.Result().Header.Get("X-Hash-Difficulty") == "" {
+		t.Error("no X-Hash-Difficulty")
+	}
+}
+
+func TestHTTPMiddleware_VerifyNonceMiddleware(t *testing.T) {
+	newMiddleware := func(nonce, hash string, extractErr error) *HTTPMiddleware {
+		m, _ := NewHTTP(&HTTPMiddleware{
+			Middleware:  &Middleware{Check: true, Secret: "secret", Difficulty: 1},
+			ExtractData: func(r *http.Request) (string, error) { return "data11111", extractErr },
+			ExtractNonce: func(r *http.Request) (string, string, error) {
+				return nonce, "5c420d7fedeb75e1309b1fe82f9c85d5552f1edfc11c72e7749330881166f18d", nil
+			},
+			ExtractHash: func(r *http.Request) (string, error) { return hash, nil },
+		})
+		return m
+	}
+
+	tests := []struct {
+		name       string
+		nonce      string
+		hash       string
+		extractErr error
+		wantCode   int
+		wantNext   bool
+	}{
+		{"valid", "nonce", "024b6380e07b20023e1b986b250b09bcfaa4551510ac4903a9b052e2b2cf9019", nil, 200, true},
+		{"no nonce", "", "024b6380e07b20023e1b986b250b09bcfaa4551510ac4903a9b052e2b2cf9019", nil, 400, false},
+		{"no hash", "nonce", "", nil, 400, false},
+		{"hash not hex", "nonce", "not hex", nil, 400, false},
+		{"wrong hash", "nonce", "2c177eecd4ad52094136dff33d30163ff0e47a95934a5c3e95abbade8700cdfd", nil, 428, false},
+		{"extract error", "nonce", "024b6380e07b20023e1b986b250b09bcfaa4551510ac4903a9b052e2b2cf9019", errors.New(""), 500, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var called bool
+			h := newMiddleware(tt.nonce, tt.hash, tt.extractErr).VerifyNonceMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+			}))
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("POST", "/", nil))
+
+			if w.Code != tt.wantCode {
+				t.Errorf("didn't return %v but %v", tt.wantCode, w.Code)
+			}
+
+			if called != tt.wantNext {
+				t.Errorf("next handler called: %v, expected: %v", called, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestHTTPMiddleware_rejections(t *testing.T) {
+	extractErr := errors.New("extract failed")
+
+	var failed *VerificationError
+	m, _ := NewHTTP(&HTTPMiddleware{
+		ExtractData: func(r *http.Request) (string, error) { return "", extractErr },
+		ExtractNonce: func(r *http.Request) (string, string, error) {
+			return "nonce", "", nil
+		},
+		OnFailedVerification: func(w http.ResponseWriter, r *http.Request, err *VerificationError) {
+			failed = err
+			w.WriteHeader(503)
+		},
+	})
+
+	w := httptest.NewRecorder()
+	m.VerifyNonceMiddleware(http.NotFoundHandler()).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	if failed == nil || failed.Code != ReasonError || failed.Phase != PhaseExtract || !errors.Is(failed, extractErr) {
+		t.Errorf("unexpected error: %+v", failed)
+	}
+
+	if w.Code != 503 {
+		t.Errorf("OnFailedVerification response not sent, instead: %v", w.Code)
+	}
+}
@@ -0,0 +1,148 @@
+package ginpow
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	gonanoid "github.com/matoous/go-nanoid"
+)
+
+// keyIDSeparator separates the id of the key a checksum was computed with from the checksum
+const keyIDSeparator = ":"
+
+// ErrUnknownKeyID is the reason given when a nonce checksum was computed with a key that is not in the `Middleware.Keyring`.
+var ErrUnknownKeyID = errors.New("nonce checksum has an unknown key id")
+
+// Keyring holds the secret keys used to compute nonce checksums and sign clearance tokens.
+// New checksums are computed with the current key and prefixed with its id, and checksums
+// computed with any key in the keyring are accepted, so keys can be rotated at runtime
+// without invalidating outstanding nonces. A Keyring is safe for concurrent use.
+type Keyring struct {
+	mu      sync.RWMutex
+	current string
+	keys    map[string]string
+}
+
+// NewKeyring returns a Keyring with a current key. If secret is empty then a 256 bit
+// cryptographically secure string is generated.
+func NewKeyring(id, secret string) (*Keyring, error) {
+	k := &Keyring{keys: make(map[string]string)}
+	if err := k.Rotate(id, secret); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Rotate adds a key and makes it the current key. The previous keys are kept for verifying
+// outstanding nonces until they are retired. If secret is empty then a 256 bit
+// cryptographically secure string is generated.
+func (k *Keyring) Rotate(id, secret string) error {
+	if id == "" || strings.Contains(id, keyIDSeparator) || strings.Contains(id, challengeSeparator) {
+		return fmt.Errorf("invalid key id %q", id)
+	}
+
+	if secret == "" {
+		var err error
+		secret, err = gonanoid.ID(32)
+		if err != nil {
+			return err
+		}
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if _, exists := k.keys[id]; exists {
+		return fmt.Errorf("key id %q is already in use", id)
+	}
+
+	if k.keys == nil {
+		k.keys = make(map[string]string)
+	}
+	k.keys[id] = secret
+	k.current = id
+	return nil
+}
+
+// Retire removes a previous key, so checksums computed with it are no longer accepted.
+// The current key can't be retired.
+func (k *Keyring) Retire(id string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if id == k.current {
+		return errors.New("can't retire the current key")
+	}
+
+	if _, exists := k.keys[id]; !exists {
+		return fmt.Errorf("unknown key id %q", id)
+	}
+
+	delete(k.keys, id)
+	return nil
+}
+
+// Current returns the id and secret of the current key.
+func (k *Keyring) Current() (id string, secret string) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.current, k.keys[k.current]
+}
+
+// Key returns the secret of the key with the given id.
+func (k *Keyring) Key(id string) (secret string, ok bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	secret, ok = k.keys[id]
+	return
+}
+
+// IDs returns the ids of the keys in the keyring.
+func (k *Keyring) IDs() []string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// signingKey returns the id and secret of the key new checksums are computed with.
+// The id is empty when `Keyring` is not set.
+func (pow *Middleware) signingKey() (string, string) {
+	if pow.Keyring == nil {
+		return "", pow.Secret
+	}
+	return pow.Keyring.Current()
+}
+
+// withKeyID prefixes a checksum with the id of the key it was computed with
+func withKeyID(id, checksum string) string {
+	if id == "" {
+		return checksum
+	}
+	return id + keyIDSeparator + checksum
+}
+
+// verificationKey returns the secret a checksum was computed with and the checksum
+// without its key id. It returns ErrUnknownKeyID if the key is not in the `Keyring`.
+func (pow *Middleware) verificationKey(checksum string) (string, string, error) {
+	if pow.Keyring == nil {
+		return pow.Secret, checksum, nil
+	}
+
+	i := strings.Index(checksum, keyIDSeparator)
+	if i < 0 {
+		return "", checksum, ErrUnknownKeyID
+	}
+
+	secret, ok := pow.Keyring.Key(checksum[:i])
+	if !ok {
+		return "", checksum[i+1:], ErrUnknownKeyID
+	}
+	return secret, checksum[i+1:], nil
+}
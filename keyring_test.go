@@ -0,0 +1,194 @@
+package ginpow
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestKeyring(t *testing.T) {
+	t.Run("invalid key id", func(t *testing.T) {
+		for _, id := range []string{"", "a:b", "a.b"} {
+			if _, err := NewKeyring(id, "secret"); err == nil {
+				t.Errorf("NewKeyring(%q) did not error", id)
+			}
+		}
+	})
+
+	t.Run("generates secret", func(t *testing.T) {
+		k, _ := NewKeyring("k1", "")
+
+		if _, secret := k.Current(); len(secret) != 32 {
+			t.Errorf("generated secret is not 32 bytes, instead: %v", len(secret))
+		}
+	})
+
+	t.Run("rotate", func(t *testing.T) {
+		k, _ := NewKeyring("k1", "s1")
+
+		if err := k.Rotate("k1", "s2"); err == nil {
+			t.Error("Rotate() did not error on a key id in use")
+		}
+
+		if err := k.Rotate("k2", "s2"); err != nil {
+			t.Fatalf("Rotate() returned error: %v", err)
+		}
+
+		if id, secret := k.Current(); id != "k2" || secret != "s2" {
+			t.Errorf("Current(); Got: %v %v, Expected: k2 s2", id, secret)
+		}
+
+		if secret, ok := k.Key("k1"); !ok || secret != "s1" {
+			t.Errorf("previous key not kept; Got: %v %v", secret, ok)
+		}
+	})
+
+	t.Run("retire", func(t *testing.T) {
+		k, _ := NewKeyring("k1", "s1")
+		k.Rotate("k2", "s2")
+
+		if err := k.Retire("k2"); err == nil {
+			t.Error("Retire() did not error on the current key")
+		}
+
+		if err := k.Retire("k1"); err != nil {
+			t.Fatalf("Retire() returned error: %v", err)
+		}
+
+		if _, ok := k.Key("k1"); ok {
+			t.Error("retired key still in keyring")
+		}
+
+		if err := k.Retire("k1"); err == nil {
+			t.Error("Retire() did not error on an unknown key")
+		}
+	})
+}
+
+func TestMiddleware_Keyring(t *testing.T) {
+	t.Run("requires check", func(t *testing.T) {
+		k, _ := NewKeyring("k1", "")
+		_, err := New(&Middleware{
+			ExtractData: func(c *gin.Context) (string, error) { return "", nil },
+			Keyring:     k,
+		})
+
+		if err == nil {
+			t.Error("New() did not error when Keyring is set without Check")
+		}
+	})
+
+	t.Run("can't set with Secret", func(t *testing.T) {
+		k, _ := NewKeyring("k1", "")
+		_, err := New(&Middleware{
+			ExtractData: func(c *gin.Context) (string, error) { return "", nil },
+			Check:       true,
+			Secret:      "secret",
+			Keyring:     k,
+		})
+
+		if err == nil {
+			t.Error("New() did not error when Secret and Keyring are both set")
+		}
+	})
+
+	t.Run("requires current key", func(t *testing.T) {
+		_, err := New(&Middleware{
+			ExtractData: func(c *gin.Context) (string, error) { return "", nil },
+			Check:       true,
+			Keyring:     &Keyring{},
+		})
+
+		if err == nil {
+			t.Error("New() did not error when Keyring has no current key")
+		}
+	})
+
+	k, _ := NewKeyring("k1", "s1")
+	m, _ := New(&Middleware{
+		ExtractData: func(c *gin.Context) (string, error) { return "data", nil },
+		Check:       true,
+		Keyring:     k,
+		Clearance:   &Clearance{TTL: time.Minute},
+	})
+
+	verify := func(nonce, nonceChecksum string) *gin.Context {
+		sum := sha256.Sum256([]byte("data" + nonce))
+		m.ExtractNonce = func(c *gin.Context) (string, string, error) { return nonce, nonceChecksum, nil }
+		m.ExtractHash = func(c *gin.Context) (string, error) { return hex.EncodeToString(sum[:]), nil }
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		m.VerifyNonceMiddleware(c)
+		return c
+	}
+
+	code := func(c *gin.Context) string {
+		if err, ok := c.Errors.Last().Err.(*VerificationError); ok {
+			return err.Code
+		}
+		return ""
+	}
+
+	t.Run("checksum has key id", func(t *testing.T) {
+		_, nonceChecksum, _ := m.generateNonce(-1, "", "", SourceGenerateNonce)
+
+		if !strings.HasPrefix(nonceChecksum, "k1:") {
+			t.Errorf("checksum is not prefixed with key id: %v", nonceChecksum)
+		}
+	})
+
+	t.Run("verifies after rotation", func(t *testing.T) {
+		nonce, nonceChecksum, _ := m.generateNonce(-1, "", "", SourceGenerateNonce)
+		token, _ := m.issueClearance("", "")
+
+		k.Rotate("k2", "s2")
+		defer k.Retire("k1")
+
+		if c := verify(nonce, nonceChecksum); len(c.Errors) > 0 {
+			t.Errorf("verification with previous key failed with error: %v", c.Errors)
+		}
+
+		if err := m.useClearance(token, "", ""); err != nil {
+			t.Errorf("clearance token signed with previous key rejected: %v", err)
+		}
+
+		nonce, nonceChecksum, _ = m.generateNonce(-1, "", "", SourceGenerateNonce)
+		if !strings.HasPrefix(nonceChecksum, "k2:") {
+			t.Errorf("checksum is not prefixed with current key id: %v", nonceChecksum)
+		}
+
+		if c := verify(nonce, nonceChecksum); len(c.Errors) > 0 {
+			t.Errorf("verification with current key failed with error: %v", c.Errors)
+		}
+	})
+
+	t.Run("unknown key id", func(t *testing.T) {
+		nonce, nonceChecksum, _ := m.generateNonce(-1, "", "", SourceGenerateNonce)
+		id, _ := k.Current()
+		k.Rotate(id+"-next", "")
+		k.Retire(id)
+
+		if c := verify(nonce, nonceChecksum); code(c) != ReasonUnknownKey {
+			t.Errorf("unexpected error for retired key: %v", c.Errors)
+		}
+
+		if c := verify(nonce, strings.TrimPrefix(nonceChecksum, id+":")); code(c) != ReasonUnknownKey {
+			t.Errorf("unexpected error for checksum without key id: %v", c.Errors)
+		}
+	})
+
+	t.Run("checksum mismatch", func(t *testing.T) {
+		nonce, _, _ := m.generateNonce(-1, "", "", SourceGenerateNonce)
+		id, _ := k.Current()
+
+		if c := verify(nonce, id+":"+strings.Repeat("00", 32)); code(c) != ReasonChecksumMismatch {
+			t.Errorf("unexpected error for bad checksum: %v", c.Errors)
+		}
+	})
+}
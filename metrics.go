@@ -0,0 +1,247 @@
+package ginpow
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// the following are the sources a challenge is issued from, reported to Collector.ChallengeIssued.
+const (
+	SourceNonceHandler          = "nonce_handler"
+	SourceNonceHeaderMiddleware = "nonce_header_middleware"
+	SourceGenerateNonce         = "generate_nonce_middleware"
+	SourceChallenge             = "failure_challenge"
+)
+
+// the following are the reasons a verification fails, reported to Collector.VerificationFailed.
+const (
+	ReasonMissingNonce           = "missing_nonce"
+	ReasonMissingChecksum        = "missing_checksum"
+	ReasonMissingHash            = "missing_hash"
+	ReasonBadHex                 = "bad_hex"
+	ReasonChecksumMismatch       = "checksum_mismatch"
+	ReasonUnknownKey             = "unknown_key"
+	ReasonHashMismatch           = "hash_mismatch"
+	ReasonInsufficientDifficulty = "insufficient_difficulty"
+	ReasonExpired                = "expired"
+	ReasonNotYetValid            = "not_yet_valid"
+	ReasonMalformed              = "malformed"
+	ReasonSpent                  = "spent"
+	ReasonScopeMismatch          = "scope_mismatch"
+	ReasonBodyTooLarge           = "body_too_large"
+	ReasonInvalidJSON            = "invalid_json"
+	ReasonError                  = "error"
+)
+
+// Collector receives metrics from a Middleware.
+type Collector interface {
+	// ChallengeIssued is called when a nonce is generated.
+	ChallengeIssued(source string)
+
+	// VerificationPassed is called when a proof is verified, with the time it took.
+	VerificationPassed(duration time.Duration)
+
+	// VerificationFailed is called when a request is rejected, with the time it took.
+	VerificationFailed(reason string, duration time.Duration)
+
+	// SetDifficulty is called with the current difficulty when a nonce is issued or verified.
+	SetDifficulty(difficulty int)
+}
+
+// DefaultLatencyBuckets are the default upper bounds in seconds of the verification latency histogram.
+var DefaultLatencyBuckets = []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1}
+
+// Metrics is a Collector that keeps metrics in memory. It is an http.Handler that
+// responds with the metrics in the Prometheus text exposition format, so it can be
+// mounted with `router.GET("/metrics", gin.WrapH(metrics))`.
+type Metrics struct {
+	// Namespace is the prefix of metric names.
+	//   Defaults to `ginpow`
+	Namespace string
+
+	// Buckets are the upper bounds in seconds of the verification latency histogram.
+	//   Defaults to DefaultLatencyBuckets
+	Buckets []float64
+
+	mu           sync.Mutex
+	issued       map[string]uint64
+	passed       uint64
+	failed       map[string]uint64
+	bucketCounts []uint64
+	latencySum   float64
+	latencyCount uint64
+	difficulty   int
+}
+
+// NewMetrics returns a Metrics with the default config.
+func NewMetrics() *Metrics {
+	return &Metrics{}
+}
+
+// ChallengeIssued implements Collector.
+func (m *Metrics) ChallengeIssued(source string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.issued == nil {
+		m.issued = make(map[string]uint64)
+	}
+	m.issued[source]++
+}
+
+// VerificationPassed implements Collector.
+func (m *Metrics) VerificationPassed(duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.passed++
+	m.observe(duration)
+}
+
+// VerificationFailed implements Collector.
+func (m *Metrics) VerificationFailed(reason string, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.failed == nil {
+		m.failed = make(map[string]uint64)
+	}
+	m.failed[reason]++
+	m.observe(duration)
+}
+
+// SetDifficulty implements Collector.
+func (m *Metrics) SetDifficulty(difficulty int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.difficulty = difficulty
+}
+
+// init validates the config of the metrics
+func (m *Metrics) init() error {
+	for i, bucket := range m.Buckets {
+		if bucket <= 0 {
+			return errors.New("pow.Metrics.Buckets must be positive")
+		}
+
+		if i > 0 && bucket <= m.Buckets[i-1] {
+			return errors.New("pow.Metrics.Buckets must be sorted in increasing order")
+		}
+	}
+	return nil
+}
+
+func (m *Metrics) buckets() []float64 {
+	if m.Buckets != nil {
+		return m.Buckets
+	}
+	return DefaultLatencyBuckets
+}
+
+// observe records a verification latency in the histogram
+func (m *Metrics) observe(duration time.Duration) {
+	buckets := m.buckets()
+	if len(m.bucketCounts) != len(buckets) {
+		m.bucketCounts = make([]uint64, len(buckets))
+	}
+
+	seconds := duration.Seconds()
+	for i, upper := range buckets {
+		if seconds <= upper {
+			m.bucketCounts[i]++
+		}
+	}
+	m.latencySum += seconds
+	m.latencyCount++
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ns := m.Namespace
+	if ns == "" {
+		ns = "ginpow"
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(200)
+
+	name := ns + "_challenges_issued_total"
+	fmt.Fprintf(w, "# HELP %s Number of nonces issued.\n# TYPE %s counter\n", name, name)
+	for _, source := range sortedKeys(m.issued) {
+		fmt.Fprintf(w, "%s{source=%q} %d\n", name, source, m.issued[source])
+	}
+
+	name = ns + "_verifications_passed_total"
+	fmt.Fprintf(w, "# HELP %s Number of proofs verified.\n# TYPE %s counter\n", name, name)
+	fmt.Fprintf(w, "%s %d\n", name, m.passed)
+
+	name = ns + "_verifications_failed_total"
+	fmt.Fprintf(w, "# HELP %s Number of requests rejected by reason.\n# TYPE %s counter\n", name, name)
+	for _, reason := range sortedKeys(m.failed) {
+		fmt.Fprintf(w, "%s{reason=%q} %d\n", name, reason, m.failed[reason])
+	}
+
+	name = ns + "_verification_duration_seconds"
+	fmt.Fprintf(w, "# HELP %s Time taken to verify a request.\n# TYPE %s histogram\n", name, name)
+	for i, upper := range m.buckets() {
+		var count uint64
+		if i < len(m.bucketCounts) {
+			count = m.bucketCounts[i]
+		}
+		fmt.Fprintf(w, "%s_bucket{le=%q} %d\n", name, strconv.FormatFloat(upper, 'g', -1, 64), count)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, m.latencyCount)
+	fmt.Fprintf(w, "%s_sum %s\n", name, strconv.FormatFloat(m.latencySum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count %d\n", name, m.latencyCount)
+
+	name = ns + "_difficulty"
+	fmt.Fprintf(w, "# HELP %s Current difficulty of issued nonces.\n# TYPE %s gauge\n", name, name)
+	fmt.Fprintf(w, "%s %d\n", name, m.difficulty)
+}
+
+func sortedKeys(m map[string]uint64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// observeIssue reports an issued nonce to the collector
+func (pow *Middleware) observeIssue(source string) {
+	if pow.Metrics == nil {
+		return
+	}
+
+	pow.Metrics.ChallengeIssued(source)
+	pow.Metrics.SetDifficulty(pow.currentDifficulty())
+}
+
+// observeVerification reports the outcome of a verification started at start to the collector
+func (pow *Middleware) observeVerification(start time.Time, err error) {
+	if pow.Metrics == nil {
+		return
+	}
+
+	pow.Metrics.SetDifficulty(pow.currentDifficulty())
+	if err == nil {
+		pow.Metrics.VerificationPassed(time.Since(start))
+	} else {
+		pow.Metrics.VerificationFailed(failureReason(err), time.Since(start))
+	}
+}
+
+// failureReason returns the reason a request was rejected with err
+func failureReason(err error) string {
+	return rejection(err).Code
+}
@@ -0,0 +1,132 @@
+package ginpow
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMetrics_ServeHTTP(t *testing.T) {
+	m := &Metrics{Buckets: []float64{.001, .01}}
+	m.ChallengeIssued(SourceNonceHandler)
+	m.ChallengeIssued(SourceNonceHandler)
+	m.ChallengeIssued(SourceGenerateNonce)
+	m.VerificationPassed(500 * time.Microsecond)
+	m.VerificationFailed(ReasonExpired, 5*time.Millisecond)
+	m.VerificationFailed(ReasonExpired, time.Second)
+	m.SetDifficulty(7)
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type: %v", ct)
+	}
+
+	for _, line := range []string{
+		"# TYPE ginpow_challenges_issued_total counter",
+		`ginpow_challenges_issued_total{source="generate_nonce_middleware"} 1`,
+		`ginpow_challenges_issued_total{source="nonce_handler"} 2`,
+		"ginpow_verifications_passed_total 1",
+		`ginpow_verifications_failed_total{reason="expired"} 2`,
+		"# TYPE ginpow_verification_duration_seconds histogram",
+		`ginpow_verification_duration_seconds_bucket{le="0.001"} 1`,
+		`ginpow_verification_duration_seconds_bucket{le="0.01"} 2`,
+		`ginpow_verification_duration_seconds_bucket{le="+Inf"} 3`,
+		"ginpow_verification_duration_seconds_count 3",
+		"# TYPE ginpow_difficulty gauge",
+		"ginpow_difficulty 7",
+	} {
+		if !strings.Contains(w.Body.String(), line+"\n") {
+			t.Errorf("missing line %q in:\n%s", line, w.Body.String())
+		}
+	}
+}
+
+func TestMiddleware_Metrics(t *testing.T) {
+	metrics := NewMetrics()
+
+	verify := func(nonce, nonceChecksum, data, hash string) {
+		m, _ := New(&Middleware{
+			Difficulty: 1,
+			Check:      true,
+			Secret:     "secret",
+			Metrics:    metrics,
+			ExtractAll: func(c *gin.Context) (string, string, string, string, error) {
+				return nonce, nonceChecksum, data, hash, nil
+			},
+		})
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		m.VerifyNonceMiddleware(c)
+	}
+
+	const (
+		nonce    = "nonce"
+		checksum = "5c420d7fedeb75e1309b1fe82f9c85d5552f1edfc11c72e7749330881166f18d"
+		hash     = "024b6380e07b20023e1b986b250b09bcfaa4551510ac4903a9b052e2b2cf9019"
+	)
+
+	verify(nonce, checksum, "data11111", hash)
+	verify(nonce, checksum, "data11111", "zz")
+	verify(nonce, strings.Repeat("0", 64), "data11111", hash)
+	verify(nonce, checksum, "other", hash)
+	verify(nonce, checksum, "a", "d9feaf290abe7a71068b95e1647359c15d2c43d2d061c1fab4ac959d77259fb3")
+
+	m, _ := New(&Middleware{
+		ExtractData: func(c *gin.Context) (string, error) { return "", nil },
+		Difficulty:  4,
+		Metrics:     metrics,
+	})
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/", nil)
+	m.NonceHeaderMiddleware(c)
+	m.VerifyNonceMiddleware(c)
+
+	w = httptest.NewRecorder()
+	metrics.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	for _, line := range []string{
+		`ginpow_challenges_issued_total{source="nonce_header_middleware"} 1`,
+		"ginpow_verifications_passed_total 1",
+		`ginpow_verifications_failed_total{reason="bad_hex"} 1`,
+		`ginpow_verifications_failed_total{reason="checksum_mismatch"} 1`,
+		`ginpow_verifications_failed_total{reason="hash_mismatch"} 1`,
+		`ginpow_verifications_failed_total{reason="insufficient_difficulty"} 1`,
+		`ginpow_verifications_failed_total{reason="missing_nonce"} 1`,
+		"ginpow_verification_duration_seconds_count 6",
+		"ginpow_difficulty 4",
+	} {
+		if !strings.Contains(w.Body.String(), line+"\n") {
+			t.Errorf("missing line %q in:\n%s", line, w.Body.String())
+		}
+	}
+}
+
+func TestMetrics_init(t *testing.T) {
+	tests := []struct {
+		name    string
+		buckets []float64
+		wantErr bool
+	}{
+		{"default", nil, false},
+		{"sorted", []float64{.001, .01, .1}, false},
+		{"unsorted", []float64{.01, .001}, true},
+		{"duplicate", []float64{.01, .01}, true},
+		{"not positive", []float64{0, .01}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(&Middleware{Metrics: &Metrics{Buckets: tt.buckets}})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package ginpow
+
+import (
+	"sync"
+	"time"
+)
+
+// NonceStore records nonces that have been consumed by a successful verification
+// so that a solved nonce cannot be replayed.
+type NonceStore interface {
+	// Spend marks the nonce as used. It returns false if the nonce has already been spent.
+	Spend(nonce string) (bool, error)
+}
+
+// MemoryNonceStore is an in-memory NonceStore. It is only suitable for a single
+// instance deployment; use a shared store when running behind a load balancer.
+type MemoryNonceStore struct {
+	// TTL is how long a spent nonce is remembered. When `Middleware.ChallengeTTL` is set,
+	//   a TTL at least as long is enough as expired nonces are rejected anyway.
+	//   Defaults to 0, in which case nonces are remembered forever.
+	TTL time.Duration
+
+	mu        sync.Mutex
+	spent     map[string]time.Time
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryNonceStore returns a MemoryNonceStore that remembers spent nonces for ttl.
+func NewMemoryNonceStore(ttl time.Duration) *MemoryNonceStore {
+	return &MemoryNonceStore{
+		TTL:   ttl,
+		spent: make(map[string]time.Time),
+		now:   time.Now,
+	}
+}
+
+// Spend implements NonceStore.
+func (s *MemoryNonceStore) Spend(nonce string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.spent == nil {
+		s.spent = make(map[string]time.Time)
+	}
+	if s.now == nil {
+		s.now = time.Now
+	}
+
+	now := s.now()
+	s.sweep(now)
+
+	if spentAt, exists := s.spent[nonce]; exists && !s.expired(spentAt, now) {
+		return false, nil
+	}
+	s.spent[nonce] = now
+	return true, nil
+}
+
+// Len returns the number of nonces currently remembered.
+func (s *MemoryNonceStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.spent)
+}
+
+func (s *MemoryNonceStore) expired(spentAt, now time.Time) bool {
+	return s.TTL > 0 && now.Sub(spentAt) >= s.TTL
+}
+
+// removes expired nonces at most once per TTL
+func (s *MemoryNonceStore) sweep(now time.Time) {
+	if s.TTL <= 0 || now.Sub(s.lastSweep) < s.TTL {
+		return
+	}
+	for nonce, spentAt := range s.spent {
+		if s.expired(spentAt, now) {
+			delete(s.spent, nonce)
+		}
+	}
+	s.lastSweep = now
+}
@@ -0,0 +1,59 @@
+package ginpow
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryNonceStore_Spend(t *testing.T) {
+	t.Run("spend once", func(t *testing.T) {
+		s := NewMemoryNonceStore(0)
+
+		if fresh, _ := s.Spend("nonce"); !fresh {
+			t.Error("first spend was not fresh")
+		}
+
+		if fresh, _ := s.Spend("nonce"); fresh {
+			t.Error("second spend was fresh")
+		}
+
+		if fresh, _ := s.Spend("other"); !fresh {
+			t.Error("spend of other nonce was not fresh")
+		}
+	})
+
+	t.Run("zero value", func(t *testing.T) {
+		var s MemoryNonceStore
+
+		if fresh, _ := s.Spend("nonce"); !fresh {
+			t.Error("first spend was not fresh")
+		}
+
+		if fresh, _ := s.Spend("nonce"); fresh {
+			t.Error("second spend was fresh")
+		}
+	})
+
+	t.Run("ttl", func(t *testing.T) {
+		now := time.Now()
+		s := NewMemoryNonceStore(time.Minute)
+		s.now = func() time.Time { return now }
+
+		s.Spend("nonce")
+		s.Spend("other")
+
+		now = now.Add(30 * time.Second)
+		if fresh, _ := s.Spend("nonce"); fresh {
+			t.Error("nonce forgotten before ttl")
+		}
+
+		now = now.Add(time.Minute)
+		if fresh, _ := s.Spend("nonce"); !fresh {
+			t.Error("nonce remembered after ttl")
+		}
+
+		if expect := 1; s.Len() != expect {
+			t.Errorf("expired nonces not swept; Got: %v, Expected: %v", s.Len(), expect)
+		}
+	})
+}
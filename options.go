@@ -0,0 +1,370 @@
+package ginpow
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	gopow "github.com/jeongy-cho/go-pow/v2"
+)
+
+// the following bound the settings validated by NewWithOptions.
+const (
+	MinNonceLength  = 8
+	MaxNonceLength  = 256
+	MinSecretLength = 16
+)
+
+// Option configures a Middleware built by NewWithOptions.
+type Option func(pow *Middleware)
+
+// ConfigError is the error of an invalid config, with every problem that was found.
+type ConfigError struct {
+	Errors []error
+}
+
+func (e *ConfigError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return "invalid ginpow config: " + strings.Join(msgs, "; ")
+}
+
+// NewWithOptions returns a new Middleware configured by opts. Unlike New, it validates every
+// setting before applying the defaults, and returns a *ConfigError with all the problems found,
+// e.g. `NewWithOptions(WithSecret(secret), WithDifficulty(16), WithChallengeTTL(time.Minute))`.
+func NewWithOptions(opts ...Option) (*Middleware, error) {
+	pow := &Middleware{}
+	for _, opt := range opts {
+		opt(pow)
+	}
+
+	if errs := pow.validate(); len(errs) > 0 {
+		return nil, &ConfigError{Errors: errs}
+	}
+
+	if err := pow.middleWareInit(); err != nil {
+		return nil, &ConfigError{Errors: []error{err}}
+	}
+	return pow, nil
+}
+
+// conflicts returns the settings that require or exclude others. New returns the first of them.
+func (pow *Middleware) conflicts() []error {
+	var errs []error
+	requireCheck := func(name string, set bool) {
+		if set && !pow.Check {
+			errs = append(errs, fmt.Errorf("pow.%v requires pow.Check", name))
+		}
+	}
+
+	requireCheck("ChallengeTTL", pow.ChallengeTTL > 0)
+	requireCheck("Scopes", len(pow.Scopes) > 0)
+	requireCheck("Keyring", pow.Keyring != nil)
+	requireCheck("Adaptive", pow.Adaptive != nil)
+	requireCheck("Binding", pow.Binding != nil)
+	requireCheck("Clearance", pow.Clearance != nil)
+	requireCheck("DifficultyFunc", pow.DifficultyFunc != nil)
+
+	if pow.Adaptive != nil && pow.ChallengeTTL <= 0 {
+		errs = append(errs, errors.New("pow.Adaptive requires pow.ChallengeTTL"))
+	}
+
+	if pow.Hash != nil && pow.Algorithm != nil {
+		errs = append(errs, errors.New("pow.Hash and pow.Algorithm can't both be set"))
+	}
+
+	if pow.Keyring != nil {
+		if pow.Secret != "" {
+			errs = append(errs, errors.New("pow.Secret and pow.Keyring can't both be set"))
+		}
+
+		if id, _ := pow.Keyring.Current(); id == "" {
+			errs = append(errs, errors.New("pow.Keyring has no current key, use NewKeyring"))
+		}
+	}
+
+	if err := pow.reportInit(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// validate returns every problem with the config, before defaults are applied
+func (pow *Middleware) validate() []error {
+	errs := pow.conflicts()
+	add := func(format string, a ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, a...))
+	}
+
+	if pow.Algorithm != nil {
+		if err := validateHashAlgorithm(pow.Algorithm); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	bits := pow.hashBits()
+	if pow.Difficulty < 0 {
+		add("pow.Difficulty must not be negative, got %v", pow.Difficulty)
+	} else if pow.Difficulty > bits {
+		add("pow.Difficulty %v exceeds the %v bit output of the hash", pow.Difficulty, bits)
+	}
+
+	if pow.Adaptive != nil {
+		if err := pow.Adaptive.validate(); err != nil {
+			errs = append(errs, err)
+		} else if pow.Adaptive.Max > bits {
+			add("pow.Adaptive.Max %v exceeds the %v bit output of the hash", pow.Adaptive.Max, bits)
+		}
+	}
+
+	if pow.Binding != nil {
+		if err := pow.Binding.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if pow.Clearance != nil {
+		if err := pow.Clearance.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if pow.NonceLength != 0 && (pow.NonceLength < MinNonceLength || pow.NonceLength > MaxNonceLength) {
+		add("pow.NonceLength must be between %v and %v, got %v", MinNonceLength, MaxNonceLength, pow.NonceLength)
+	}
+
+	if pow.Secret != "" && len(pow.Secret) < MinSecretLength {
+		add("pow.Secret must be at least %v bytes, got %v", MinSecretLength, len(pow.Secret))
+	}
+
+	if pow.Keyring != nil {
+		for _, id := range pow.Keyring.IDs() {
+			if secret, _ := pow.Keyring.Key(id); len(secret) < MinSecretLength {
+				add("pow.Keyring key %q must be at least %v bytes, got %v", id, MinSecretLength, len(secret))
+			}
+		}
+	}
+
+	if pow.FailureStatusCode != 0 && (pow.FailureStatusCode < 400 || pow.FailureStatusCode > 499) {
+		add("pow.FailureStatusCode must be a 4xx status code, got %v", pow.FailureStatusCode)
+	}
+
+	if pow.MaxBodySize < 0 {
+		add("pow.MaxBodySize must not be negative, got %v", pow.MaxBodySize)
+	}
+
+	if pow.ChallengeTTL < 0 {
+		add("pow.ChallengeTTL must not be negative, got %v", pow.ChallengeTTL)
+	}
+
+	if pow.ExtractAll != nil {
+		if pow.ExtractData != nil || pow.ExtractNonce != nil || pow.ExtractHash != nil {
+			add("pow.ExtractAll can't be set with pow.ExtractData, pow.ExtractNonce or pow.ExtractHash, which it overrides")
+		}
+
+		if pow.NonceSource != "" || pow.NonceChecksumSource != "" || pow.HashSource != "" || pow.DataSource != "" {
+			add("pow.ExtractAll can't be set with a source, which it overrides")
+		}
+	}
+
+	if pow.ExtractNonce != nil && (pow.NonceSource != "" || pow.NonceChecksumSource != "") {
+		add("pow.ExtractNonce can't be set with pow.NonceSource or pow.NonceChecksumSource, which it overrides")
+	}
+
+	if pow.ExtractHash != nil && pow.HashSource != "" {
+		add("pow.ExtractHash can't be set with pow.HashSource, which it overrides")
+	}
+
+	if pow.ExtractData != nil && pow.DataSource != "" {
+		add("pow.ExtractData can't be set with pow.DataSource, which it overrides")
+	}
+
+	if _, _, _, _, err := pow.sources(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// hashBits is the size in bits of the output of the hash proofs are verified with. The
+// declared size of the built in algorithms is used, so that they aren't run to find it.
+// Other hashes are run, so New computes it once into hashSize.
+func (pow *Middleware) hashBits() int {
+	if pow.Algorithm != nil {
+		if validateHashAlgorithm(pow.Algorithm) != nil {
+			return 0
+		}
+
+		if alg, ok := pow.Algorithm.(interface{ size() int }); ok {
+			return alg.size() * 8
+		}
+		return len(pow.Algorithm.Sum(nil)) * 8
+	}
+
+	if pow.Hash != nil {
+		return len(pow.Hash(nil)) * 8
+	}
+	return 256
+}
+
+// WithDifficulty sets `Middleware.Difficulty`.
+func WithDifficulty(difficulty int) Option {
+	return func(pow *Middleware) { pow.Difficulty = difficulty }
+}
+
+// WithNonceLength sets `Middleware.NonceLength`.
+func WithNonceLength(length int) Option {
+	return func(pow *Middleware) { pow.NonceLength = length }
+}
+
+// WithCheck sets `Middleware.Check`, with a generated secret.
+func WithCheck() Option {
+	return func(pow *Middleware) { pow.Check = true }
+}
+
+// WithSecret sets `Middleware.Check` with secret.
+func WithSecret(secret string) Option {
+	return func(pow *Middleware) {
+		pow.Check = true
+		pow.Secret = secret
+	}
+}
+
+// WithKeyring sets `Middleware.Check` with the keys of k.
+func WithKeyring(k *Keyring) Option {
+	return func(pow *Middleware) {
+		pow.Check = true
+		pow.Keyring = k
+	}
+}
+
+// WithChallengeTTL sets `Middleware.ChallengeTTL`.
+func WithChallengeTTL(ttl time.Duration) Option {
+	return func(pow *Middleware) { pow.ChallengeTTL = ttl }
+}
+
+// WithScopes sets `Middleware.Scopes`.
+func WithScopes(scopes ...string) Option {
+	return func(pow *Middleware) { pow.Scopes = scopes }
+}
+
+// WithAlgorithm sets `Middleware.Algorithm`.
+func WithAlgorithm(alg HashAlgorithm) Option {
+	return func(pow *Middleware) { pow.Algorithm = alg }
+}
+
+// WithHash sets `Middleware.Hash`.
+func WithHash(hash gopow.HashFunction) Option {
+	return func(pow *Middleware) { pow.Hash = hash }
+}
+
+// WithAdaptive sets `Middleware.Adaptive`.
+func WithAdaptive(a *AdaptiveDifficulty) Option {
+	return func(pow *Middleware) { pow.Adaptive = a }
+}
+
+// WithBinding sets `Middleware.Binding`.
+func WithBinding(b *Binding) Option {
+	return func(pow *Middleware) { pow.Binding = b }
+}
+
+// WithClearance sets `Middleware.Clearance`.
+func WithClearance(cl *Clearance) Option {
+	return func(pow *Middleware) { pow.Clearance = cl }
+}
+
+// WithNonceStore sets `Middleware.NonceStore`.
+func WithNonceStore(store NonceStore) Option {
+	return func(pow *Middleware) { pow.NonceStore = store }
+}
+
+// WithMetrics sets `Middleware.Metrics`.
+func WithMetrics(metrics Collector) Option {
+	return func(pow *Middleware) { pow.Metrics = metrics }
+}
+
+// WithExtractAll sets `Middleware.ExtractAll`.
+func WithExtractAll(extract func(c *gin.Context) (nonce string, nonceChecksum string, data string, hash string, err error)) Option {
+	return func(pow *Middleware) { pow.ExtractAll = extract }
+}
+
+// WithExtractData sets `Middleware.ExtractData`.
+func WithExtractData(extract func(c *gin.Context) (string, error)) Option {
+	return func(pow *Middleware) { pow.ExtractData = extract }
+}
+
+// WithExtractNonce sets `Middleware.ExtractNonce`.
+func WithExtractNonce(extract func(c *gin.Context) (nonce string, nonceChecksum string, err error)) Option {
+	return func(pow *Middleware) { pow.ExtractNonce = extract }
+}
+
+// WithExtractHash sets `Middleware.ExtractHash`.
+func WithExtractHash(extract func(c *gin.Context) (hash string, err error)) Option {
+	return func(pow *Middleware) { pow.ExtractHash = extract }
+}
+
+// WithSources sets `Middleware.NonceSource`, `Middleware.NonceChecksumSource`,
+// `Middleware.HashSource` and `Middleware.DataSource`. Empty sources keep their defaults.
+func WithSources(nonce, nonceChecksum, hash, data string) Option {
+	return func(pow *Middleware) {
+		pow.NonceSource = nonce
+		pow.NonceChecksumSource = nonceChecksum
+		pow.HashSource = hash
+		pow.DataSource = data
+	}
+}
+
+// WithMaxBodySize sets `Middleware.MaxBodySize`.
+func WithMaxBodySize(size int64) Option {
+	return func(pow *Middleware) { pow.MaxBodySize = size }
+}
+
+// WithFailureStatusCode sets `Middleware.FailureStatusCode`.
+func WithFailureStatusCode(code int) Option {
+	return func(pow *Middleware) { pow.FailureStatusCode = code }
+}
+
+// WithChallengeOnFailure sets `Middleware.ChallengeOnFailure`.
+func WithChallengeOnFailure() Option {
+	return func(pow *Middleware) { pow.ChallengeOnFailure = true }
+}
+
+// WithProblemDetails sets `Middleware.ProblemDetails`, with the optional `Middleware.NonceURL`.
+func WithProblemDetails(nonceURL string) Option {
+	return func(pow *Middleware) {
+		pow.ProblemDetails = true
+		pow.NonceURL = nonceURL
+	}
+}
+
+// WithReportOnly sets `Middleware.ReportOnly` with `Middleware.EnforcePercent`.
+func WithReportOnly(enforcePercent int) Option {
+	return func(pow *Middleware) {
+		pow.ReportOnly = true
+		pow.EnforcePercent = enforcePercent
+	}
+}
+
+// WithOnFailedVerification sets `Middleware.OnFailedVerification`.
+func WithOnFailedVerification(fn func(c *gin.Context, err *VerificationError)) Option {
+	return func(pow *Middleware) { pow.OnFailedVerification = fn }
+}
+
+// WithHooks sets `Middleware.OnIssue`, `Middleware.OnVerified` and `Middleware.OnRejected`.
+func WithHooks(onIssue func(c *gin.Context, ch *IssuedChallenge), onVerified func(c *gin.Context, res *VerificationResult), onRejected func(c *gin.Context, err *VerificationError)) Option {
+	return func(pow *Middleware) {
+		pow.OnIssue = onIssue
+		pow.OnVerified = onVerified
+		pow.OnRejected = onRejected
+	}
+}
+
+// WithConfig applies fn to the Middleware, for settings without an Option.
+func WithConfig(fn func(pow *Middleware)) Option {
+	return Option(fn)
+}
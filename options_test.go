@@ -0,0 +1,138 @@
+package ginpow
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNewWithOptions(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		m, err := NewWithOptions(
+			WithSecret("0123456789abcdef"),
+			WithDifficulty(16),
+			WithChallengeTTL(time.Minute),
+			WithSources("query:nonce", "", "", ""),
+		)
+		if err != nil {
+			t.Fatalf("NewWithOptions() returned error: %v", err)
+		}
+
+		if !m.Check || m.Difficulty != 16 || m.ChallengeTTL != time.Minute || m.NonceSource != "query:nonce" {
+			t.Errorf("options not applied: %+v", m)
+		}
+
+		if m.FailureStatusCode != 428 || m.HashSource != "header:X-Hash" || m.ExtractData == nil || m.OnFailedVerification == nil {
+			t.Error("defaults not set")
+		}
+	})
+
+	t.Run("aggregated errors", func(t *testing.T) {
+		_, err := NewWithOptions(
+			WithDifficulty(-1),
+			WithNonceLength(4),
+			WithFailureStatusCode(200),
+			WithScopes("GET /"),
+			WithExtractAll(func(c *gin.Context) (string, string, string, string, error) { return "", "", "", "", nil }),
+			WithExtractData(func(c *gin.Context) (string, error) { return "", nil }),
+		)
+
+		var configErr *ConfigError
+		if !errors.As(err, &configErr) {
+			t.Fatalf("NewWithOptions() did not return a *ConfigError: %v", err)
+		}
+
+		if len(configErr.Errors) != 5 {
+			t.Errorf("unexpected errors; Got: %v", configErr.Errors)
+		}
+
+		for _, field := range []string{"Difficulty", "NonceLength", "FailureStatusCode", "Scopes", "ExtractAll"} {
+			if !strings.Contains(err.Error(), "pow."+field) {
+				t.Errorf("error does not mention %v: %v", field, err)
+			}
+		}
+	})
+
+	t.Run("aggregated init errors", func(t *testing.T) {
+		_, err := NewWithOptions(
+			WithCheck(),
+			WithChallengeTTL(time.Minute),
+			WithAdaptive(&AdaptiveDifficulty{Min: 4, Max: 2}),
+			WithBinding(&Binding{ClientIP: true, TrustedProxies: []string{"proxy"}}),
+			WithClearance(&Clearance{MaxUses: 1}),
+		)
+
+		var configErr *ConfigError
+		if !errors.As(err, &configErr) || len(configErr.Errors) != 3 {
+			t.Errorf("unexpected errors; Got: %v", err)
+		}
+	})
+
+	t.Run("DifficultyFunc requires check", func(t *testing.T) {
+		_, err := NewWithOptions(func(pow *Middleware) { pow.DifficultyFunc = func(c *gin.Context) int { return 0 } })
+
+		var configErr *ConfigError
+		if !errors.As(err, &configErr) || len(configErr.Errors) != 1 || !strings.Contains(err.Error(), "pow.DifficultyFunc requires pow.Check") {
+			t.Errorf("unexpected errors; Got: %v", err)
+		}
+	})
+
+	keyring, _ := NewKeyring("short", "secret")
+
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{"difficulty exceeds hash", []Option{WithDifficulty(257)}},
+		{"difficulty exceeds algorithm", []Option{WithAlgorithm(Scrypt{N: 1024, R: 8, P: 1, KeyLength: 8}), WithDifficulty(65)}},
+		{"nonce length", []Option{WithNonceLength(1000)}},
+		{"short secret", []Option{WithSecret("secret")}},
+		{"short keyring key", []Option{WithKeyring(keyring)}},
+		{"negative ttl", []Option{WithChallengeTTL(-time.Second)}},
+		{"negative body size", []Option{WithMaxBodySize(-1)}},
+		{"enforce percent", []Option{WithReportOnly(101)}},
+		{"invalid source", []Option{WithSources("", "", "body:hash", "")}},
+		{"source and extractor", []Option{WithSources("", "", "header:X-Proof", ""), WithExtractHash(func(c *gin.Context) (string, error) { return "", nil })}},
+		{"init error", []Option{WithCheck(), WithClearance(&Clearance{})}},
+		{"adaptive exceeds hash", []Option{WithCheck(), WithAdaptive(&AdaptiveDifficulty{Max: 257, RaiseAt: 10})}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewWithOptions(tt.opts...); err == nil {
+				t.Error("NewWithOptions() did not error")
+			}
+		})
+	}
+
+	t.Run("New keeps working", func(t *testing.T) {
+		if _, err := New(&Middleware{NonceLength: 4, Secret: "secret", Check: true}); err != nil {
+			t.Errorf("New() returned error: %v", err)
+		}
+	})
+}
+
+func TestMiddleware_hashBits(t *testing.T) {
+	tests := []struct {
+		name   string
+		pow    *Middleware
+		expect int
+	}{
+		{"default", &Middleware{}, 256},
+		{"sha256", &Middleware{Algorithm: SHA256{}}, 256},
+		{"argon2id", &Middleware{Algorithm: Argon2id{KeyLength: 16}}, 128},
+		{"scrypt", &Middleware{Algorithm: &Scrypt{}}, 256},
+		{"hash", &Middleware{Hash: func(b []byte) []byte { return make([]byte, 20) }}, 160},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.pow.hashBits(); got != tt.expect {
+				t.Errorf("hashBits(); Got: %v, Expected: %v", got, tt.expect)
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package ginpow
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// the following are the media types of problem details, see RFC 7807.
+const (
+	MIMEProblemJSON = "application/problem+json"
+	MIMEProblemXML  = "application/problem+xml"
+)
+
+// ProblemTypePrefix is the prefix of the `type` of problem details, followed by the error code,
+// e.g. `urn:ginpow:problem:expired`.
+const ProblemTypePrefix = "urn:ginpow:problem:"
+
+// problemTitles are the titles of the problem types of each error code
+var problemTitles = map[string]string{
+	ReasonMissingNonce:           "Missing nonce",
+	ReasonMissingChecksum:        "Missing nonce checksum",
+	ReasonMissingHash:            "Missing hash",
+	ReasonBadHex:                 "Malformed hex string",
+	ReasonChecksumMismatch:       "Nonce checksum mismatch",
+	ReasonUnknownKey:             "Unknown nonce checksum key",
+	ReasonHashMismatch:           "Hash mismatch",
+	ReasonInsufficientDifficulty: "Insufficient difficulty",
+	ReasonExpired:                "Nonce expired",
+	ReasonNotYetValid:            "Nonce not yet valid",
+	ReasonMalformed:              "Malformed nonce",
+	ReasonSpent:                  "Nonce already spent",
+	ReasonScopeMismatch:          "Scope mismatch",
+	ReasonBodyTooLarge:           "Request body too large",
+	ReasonInvalidJSON:            "Invalid JSON body",
+	ReasonError:                  "Internal error",
+}
+
+// Problem is the RFC 7807 problem details a request is rejected with when
+// `Middleware.ProblemDetails` is set. Code is one of the Reason constants, and the
+// fields of a VerificationError are included when the request failed verification.
+type Problem struct {
+	XMLName xml.Name `json:"-" xml:"urn:ietf:rfc:7807 problem"`
+
+	Type   string `json:"type" xml:"type"`
+	Title  string `json:"title" xml:"title"`
+	Status int    `json:"status" xml:"status"`
+	Detail string `json:"detail,omitempty" xml:"detail,omitempty"`
+	Code   string `json:"code" xml:"code"`
+
+	Nonce         string `json:"nonce,omitempty" xml:"nonce,omitempty"`
+	NonceChecksum string `json:"nonce_checksum,omitempty" xml:"nonce_checksum,omitempty"`
+	Hash          string `json:"hash,omitempty" xml:"hash,omitempty"`
+	Difficulty    int    `json:"difficulty,omitempty" xml:"difficulty,omitempty"`
+
+	// NonceURL is `Middleware.NonceURL`, where a client can get a new nonce.
+	NonceURL string `json:"nonce_url,omitempty" xml:"nonce_url,omitempty"`
+
+	// Challenge is a fresh nonce like NonceHandler responds with, when `Middleware.ChallengeOnFailure` is set.
+	Challenge ProblemChallenge `json:"challenge,omitempty" xml:"challenge,omitempty"`
+}
+
+// ProblemChallenge is a fresh nonce in problem details, keyed like the data of NonceHandler.
+type ProblemChallenge map[string]interface{}
+
+// MarshalXML encodes the entries of a challenge as child elements in key order.
+func (ch ProblemChallenge) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(ch))
+	for key := range ch {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if err := e.EncodeElement(ch[key], xml.StartElement{Name: xml.Name{Local: key}}); err != nil {
+			return err
+		}
+	}
+
+	return e.EncodeToken(start.End())
+}
+
+// problem returns the problem details of a request rejected with status and err.
+// The message of an internal error is not included.
+func (pow *Middleware) problem(status int, err error) *Problem {
+	p := &Problem{
+		Status:   status,
+		Code:     ReasonError,
+		NonceURL: pow.NonceURL,
+	}
+
+	switch err := err.(type) {
+	case badRequestError:
+		p.Code = err.code
+		p.Detail = err.message
+	case *VerificationError:
+		if err.Code != "" {
+			p.Code = err.Code
+		}
+		if p.Code != ReasonError {
+			p.Detail = err.Reason
+		}
+		p.Nonce = err.Nonce
+		p.NonceChecksum = err.NonceChecksum
+		p.Hash = err.Hash
+		p.Difficulty = err.Difficulty
+	}
+
+	p.Type = ProblemTypePrefix + p.Code
+	p.Title = problemTitles[p.Code]
+	if p.Title == "" {
+		p.Title = http.StatusText(status)
+	}
+	return p
+}
+
+// problemRender renders problem details as JSON or XML
+type problemRender struct {
+	problem *Problem
+	xml     bool
+}
+
+// Render implements render.Render.
+func (r problemRender) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+
+	if r.xml {
+		return xml.NewEncoder(w).Encode(r.problem)
+	}
+	return json.NewEncoder(w).Encode(r.problem)
+}
+
+// WriteContentType implements render.Render.
+func (r problemRender) WriteContentType(w http.ResponseWriter) {
+	if r.xml {
+		w.Header().Set("Content-Type", MIMEProblemXML+"; charset=utf-8")
+		return
+	}
+	w.Header().Set("Content-Type", MIMEProblemJSON+"; charset=utf-8")
+}
+
+// problemOffers are the media types problem details can be negotiated as
+var problemOffers = []string{MIMEProblemJSON, MIMEProblemXML, gin.MIMEJSON, gin.MIMEXML}
+
+// newProblemRender renders problem details as XML if the negotiated format is XML, otherwise as JSON
+func newProblemRender(p *Problem, format string) problemRender {
+	return problemRender{
+		problem: p,
+		xml:     format == MIMEProblemXML || format == gin.MIMEXML,
+	}
+}
+
+// abortProblem aborts a request with problem details
+func abortProblem(c *gin.Context, p *Problem) {
+	c.Abort()
+	c.Render(p.Status, newProblemRender(p, c.NegotiateFormat(problemOffers...)))
+}
+
+// writeProblem responds with problem details
+func writeProblem(w http.ResponseWriter, r *http.Request, p *Problem) {
+	rd := newProblemRender(p, negotiateFormat(r, problemOffers...))
+	rd.WriteContentType(w)
+	w.WriteHeader(p.Status)
+	rd.Render(w)
+}
+
+// errorStatus is the status code a request rejected with an error other than a failed verification is responded to with
+func errorStatus(err error) int {
+	if _, ok := err.(badRequestError); ok {
+		return 400
+	}
+	return 500
+}
+
+// abortError aborts a request with a 400 for a badRequestError, or a 500 for any other error
+func (pow *Middleware) abortError(c *gin.Context, err error) {
+	status := errorStatus(err)
+	if status == 500 {
+		c.Error(err)
+	}
+
+	if pow.ProblemDetails {
+		abortProblem(c, pow.problem(status, err))
+		return
+	}
+
+	if status == 400 {
+		c.String(400, err.Error())
+		c.Abort()
+		return
+	}
+	c.AbortWithStatus(500)
+}
+
+// abortIssue responds to an error generating a nonce
+func (pow *Middleware) abortIssue(c *gin.Context, err error) {
+	if _, ok := err.(badRequestError); ok || pow.ProblemDetails {
+		pow.abortError(c, err)
+		return
+	}
+	c.Error(err)
+}
+
+// respondProblem responds to a failed verification with problem details, including
+// the nonce set by setChallenge when `ChallengeOnFailure` is set
+func (pow *Middleware) respondProblem(c *gin.Context, err *VerificationError) {
+	p := pow.problem(pow.failureStatus(err), err)
+	if pow.challenged(err) {
+		nonce, nonceChecksum, _ := pow.getNonce(c, SourceChallenge)
+		p.Challenge = ProblemChallenge(pow.nonceData(nonce, nonceChecksum))
+	}
+
+	abortProblem(c, p)
+}
+
+// writeError responds with a 400 for a badRequestError, or a 500 for any other error
+func (pow *HTTPMiddleware) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	status := errorStatus(err)
+
+	if pow.ProblemDetails {
+		writeProblem(w, r, pow.problem(status, err))
+		return
+	}
+
+	if status == 400 {
+		writeString(w, 400, err.Error())
+		return
+	}
+	w.WriteHeader(500)
+}
+
+// respondProblem responds to a failed verification with problem details, including
+// the nonce set by setChallenge when `ChallengeOnFailure` is set
+func (pow *HTTPMiddleware) respondProblem(w http.ResponseWriter, r *http.Request, err *VerificationError) {
+	p := pow.problem(pow.failureStatus(err), err)
+	if pow.challenged(err) {
+		nonce, nonceChecksum, _ := pow.getNonce(r, SourceChallenge)
+		p.Challenge = ProblemChallenge(pow.nonceData(nonce, nonceChecksum))
+	}
+
+	writeProblem(w, r, p)
+}
@@ -0,0 +1,187 @@
+package ginpow
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMiddleware_ProblemDetails(t *testing.T) {
+	m, _ := New(&Middleware{
+		ExtractData:    func(c *gin.Context) (string, error) { return "data", nil },
+		Check:          true,
+		Difficulty:     8,
+		ProblemDetails: true,
+		NonceURL:       "/nonce",
+	})
+
+	r := gin.New()
+	r.GET("/", m.VerifyNonceMiddleware, func(c *gin.Context) { c.Status(200) })
+
+	serve := func(accept string, header map[string]string) (*httptest.ResponseRecorder, Problem) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept", accept)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		r.ServeHTTP(w, req)
+
+		var p Problem
+		if strings.Contains(w.Header().Get("Content-Type"), "xml") {
+			xml.Unmarshal(w.Body.Bytes(), &p)
+		} else {
+			json.Unmarshal(w.Body.Bytes(), &p)
+		}
+		return w, p
+	}
+
+	t.Run("missing proof", func(t *testing.T) {
+		w, p := serve("", nil)
+
+		if w.Code != 400 {
+			t.Errorf("missing proof returned %v, expected 400", w.Code)
+		}
+
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, MIMEProblemJSON) {
+			t.Errorf("unexpected content type: %v", ct)
+		}
+
+		expect := Problem{
+			Type:     ProblemTypePrefix + ReasonMissingNonce,
+			Title:    "Missing nonce",
+			Status:   400,
+			Detail:   "no nonce in request",
+			Code:     ReasonMissingNonce,
+			NonceURL: "/nonce",
+		}
+		if p.Type != expect.Type || p.Title != expect.Title || p.Status != expect.Status ||
+			p.Detail != expect.Detail || p.Code != expect.Code || p.NonceURL != expect.NonceURL {
+			t.Errorf("problem; Got: %+v, Expected: %+v", p, expect)
+		}
+	})
+
+	t.Run("failed proof", func(t *testing.T) {
+		w, p := serve(gin.MIMEJSON, map[string]string{
+			"X-Nonce":          "nonce",
+			"X-Nonce-Checksum": "00",
+			"X-Hash":           "00",
+		})
+
+		if w.Code != 428 {
+			t.Errorf("failed proof returned %v, expected 428", w.Code)
+		}
+
+		if p.Status != 428 || p.Code != ReasonChecksumMismatch || p.Nonce != "nonce" || p.NonceChecksum != "00" ||
+			p.Hash != "00" || p.Difficulty != 8 || p.Detail == "" {
+			t.Errorf("unexpected problem: %+v", p)
+		}
+	})
+
+	t.Run("xml", func(t *testing.T) {
+		w, p := serve(MIMEProblemXML, nil)
+
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, MIMEProblemXML) {
+			t.Errorf("unexpected content type: %v", ct)
+		}
+
+		if !strings.Contains(w.Body.String(), `xmlns="urn:ietf:rfc:7807"`) {
+			t.Errorf("problem is not in the RFC 7807 namespace: %v", w.Body.String())
+		}
+
+		if p.Code != ReasonMissingNonce {
+			t.Errorf("code; Got: %v, Expected: %v", p.Code, ReasonMissingNonce)
+		}
+	})
+
+	t.Run("internal error", func(t *testing.T) {
+		m, _ := New(&Middleware{
+			ExtractData:    func(c *gin.Context) (string, error) { return "", errors.New("secret failure") },
+			ProblemDetails: true,
+		})
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/", nil)
+		c.Request.Header.Set("X-Nonce", "nonce")
+		m.VerifyNonceMiddleware(c)
+
+		if w.Code != 500 || !strings.Contains(w.Body.String(), `"code":"error"`) {
+			t.Errorf("unexpected response: %v %v", w.Code, w.Body.String())
+		}
+
+		if strings.Contains(w.Body.String(), "secret failure") {
+			t.Error("internal error message leaked in problem")
+		}
+
+		if len(c.Errors) != 1 {
+			t.Errorf("internal error not set on context: %v", c.Errors)
+		}
+	})
+
+	t.Run("with challenge", func(t *testing.T) {
+		m, _ := New(&Middleware{
+			ExtractData:        func(c *gin.Context) (string, error) { return "data", nil },
+			ProblemDetails:     true,
+			ChallengeOnFailure: true,
+		})
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/", nil)
+		c.Request.Header.Set("Accept", MIMEProblemXML)
+		m.VerifyNonceMiddleware(c)
+
+		nonce := c.GetString("nonce")
+		if w.Code != 428 || nonce == "" || !strings.Contains(w.Body.String(), "<challenge><difficulty>0</difficulty><nonce>"+nonce+"</nonce></challenge>") {
+			t.Errorf("unexpected response: %v %v", w.Code, w.Body.String())
+		}
+	})
+}
+
+func TestHTTPMiddleware_ProblemDetails(t *testing.T) {
+	m, _ := NewHTTP(&HTTPMiddleware{
+		Middleware:  &Middleware{ProblemDetails: true},
+		ExtractData: func(r *http.Request) (string, error) { return "data", nil },
+	})
+
+	h := m.VerifyNonceMiddleware(http.NotFoundHandler())
+
+	t.Run("missing proof", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+		var p Problem
+		json.Unmarshal(w.Body.Bytes(), &p)
+
+		if w.Code != 400 || p.Status != 400 || p.Code != ReasonMissingNonce {
+			t.Errorf("unexpected response: %v %+v", w.Code, p)
+		}
+	})
+
+	t.Run("failed proof", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", gin.MIMEXML)
+		r.Header.Set("X-Nonce", "nonce")
+		r.Header.Set("X-Hash", "00")
+		h.ServeHTTP(w, r)
+
+		var p Problem
+		xml.Unmarshal(w.Body.Bytes(), &p)
+
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, MIMEProblemXML) {
+			t.Errorf("unexpected content type: %v", ct)
+		}
+
+		if w.Code != 428 || p.Status != 428 || p.Code != ReasonHashMismatch || p.Nonce != "nonce" {
+			t.Errorf("unexpected response: %v %+v", w.Code, p)
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package ginpow
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// randIntn is replaced in tests
+var randIntn = rand.Intn
+
+// reportInit checks the config of report only mode
+func (pow *Middleware) reportInit() error {
+	if pow.EnforcePercent < 0 || pow.EnforcePercent > 100 {
+		return errors.New("pow.EnforcePercent must be between 0 and 100")
+	}
+
+	if pow.EnforcePercent > 0 && !pow.ReportOnly {
+		return errors.New("pow.EnforcePercent requires pow.ReportOnly")
+	}
+
+	return nil
+}
+
+// enforced reports whether a failed verification of a request is rejected, which is
+// always unless `ReportOnly` is set, then for `EnforcePercent` percent of requests
+func (pow *Middleware) enforced() bool {
+	return !pow.ReportOnly || randIntn(100) < pow.EnforcePercent
+}
+
+// report records a failed verification that isn't enforced in the context and calls OnReport
+func (pow *Middleware) report(c *gin.Context, err *VerificationError) {
+	c.Set(pow.VerificationErrorContextKey, err)
+
+	if pow.OnReport != nil {
+		pow.OnReport(c, err)
+	}
+}
+
+// report records a failed verification that isn't enforced in the returned request's
+// context and calls OnReport
+func (pow *HTTPMiddleware) report(r *http.Request, err *VerificationError) *http.Request {
+	r = r.WithContext(context.WithValue(r.Context(), contextKey(pow.VerificationErrorContextKey), err))
+
+	if pow.OnReport != nil {
+		pow.OnReport(r, err)
+	}
+	return r
+}
+
+// VerificationErrorFromContext returns the failed verification set in a request context
+// by VerifyNonceMiddleware in report only mode.
+func (pow *HTTPMiddleware) VerificationErrorFromContext(ctx context.Context) (*VerificationError, bool) {
+	err, ok := ctx.Value(contextKey(pow.VerificationErrorContextKey)).(*VerificationError)
+	return err, ok
+}
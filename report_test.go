@@ -0,0 +1,152 @@
+package ginpow
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// withRandIntn stubs the random number requests are chosen for enforcement with
+func withRandIntn(t *testing.T, n int) {
+	randIntn = func(int) int { return n }
+	t.Cleanup(func() { randIntn = rand.Intn })
+}
+
+func TestMiddleware_ReportOnly(t *testing.T) {
+	t.Run("invalid config", func(t *testing.T) {
+		for _, m := range []*Middleware{
+			{ReportOnly: true, EnforcePercent: -1},
+			{ReportOnly: true, EnforcePercent: 101},
+			{EnforcePercent: 50},
+		} {
+			m.ExtractData = func(c *gin.Context) (string, error) { return "", nil }
+			if _, err := New(m); err == nil {
+				t.Errorf("New() did not error with ReportOnly: %v, EnforcePercent: %v", m.ReportOnly, m.EnforcePercent)
+			}
+		}
+	})
+
+	var reported *VerificationError
+	metrics := NewMetrics()
+	m, _ := New(&Middleware{
+		ExtractData:    func(c *gin.Context) (string, error) { return "data", nil },
+		Metrics:        metrics,
+		ReportOnly:     true,
+		EnforcePercent: 25,
+		OnReport:       func(c *gin.Context, err *VerificationError) { reported = err },
+	})
+
+	serve := func() (*httptest.ResponseRecorder, interface{}, bool) {
+		reported = nil
+
+		var verificationErr interface{}
+		var called bool
+
+		r := gin.New()
+		r.GET("/", m.VerifyNonceMiddleware, func(c *gin.Context) {
+			called = true
+			verificationErr, _ = c.Get("verificationError")
+			c.Status(200)
+		})
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		return w, verificationErr, called
+	}
+
+	t.Run("reported", func(t *testing.T) {
+		withRandIntn(t, 25)
+
+		w, verificationErr, called := serve()
+
+		if !called || w.Code != 200 {
+			t.Fatalf("request rejected in report only mode: %v", w.Code)
+		}
+
+		if err, ok := verificationErr.(*VerificationError); !ok || err.Code != ReasonMissingNonce {
+			t.Errorf("failed verification not set in context: %v", verificationErr)
+		}
+
+		if reported == nil || reported.Code != ReasonMissingNonce {
+			t.Errorf("OnReport not called with failed verification: %v", reported)
+		}
+
+		if metrics.failed[ReasonMissingNonce] == 0 {
+			t.Error("failed verification not reported to metrics")
+		}
+	})
+
+	t.Run("enforced", func(t *testing.T) {
+		withRandIntn(t, 24)
+
+		w, _, called := serve()
+
+		if called || w.Code != 400 {
+			t.Errorf("request not rejected; next called: %v, code: %v", called, w.Code)
+		}
+
+		if reported != nil {
+			t.Errorf("OnReport called for an enforced failure: %v", reported)
+		}
+	})
+
+	t.Run("body too large", func(t *testing.T) {
+		m, err := New(&Middleware{MaxBodySize: 4, ReportOnly: true})
+		if err != nil {
+			t.Fatalf("New() returned error: %v", err)
+		}
+
+		var body []byte
+		var res *VerificationResult
+		r := gin.New()
+		r.POST("/", m.VerifyNonceMiddleware, func(c *gin.Context) {
+			body, _ = ioutil.ReadAll(c.Request.Body)
+			res, _ = Result(c)
+		})
+
+		req := httptest.NewRequest("POST", "/", strings.NewReader("0123456789"))
+		req.Header.Set("X-Nonce", "nonce")
+		req.Header.Set("X-Hash", "00")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+
+		if res == nil || res.Err == nil || res.Err.Code != ReasonBodyTooLarge {
+			t.Errorf("body too large not reported; Got: %+v", res)
+		}
+
+		if string(body) != "0123456789" {
+			t.Errorf("body not restored; Got: %q, Expected: %q", body, "0123456789")
+		}
+	})
+}
+
+func TestHTTPMiddleware_ReportOnly(t *testing.T) {
+	withRandIntn(t, 0)
+
+	var reported *VerificationError
+	m, _ := NewHTTP(&HTTPMiddleware{
+		Middleware:  &Middleware{ReportOnly: true},
+		ExtractData: func(r *http.Request) (string, error) { return "data", nil },
+		OnReport:    func(r *http.Request, err *VerificationError) { reported = err },
+	})
+
+	var fromContext *VerificationError
+	h := m.VerifyNonceMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fromContext, _ = m.VerificationErrorFromContext(r.Context())
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	if w.Code != 200 {
+		t.Errorf("request rejected in report only mode: %v", w.Code)
+	}
+
+	if fromContext == nil || fromContext != reported || fromContext.Code != ReasonMissingNonce {
+		t.Errorf("failed verification not reported; context: %v, OnReport: %v", fromContext, reported)
+	}
+}
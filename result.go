@@ -0,0 +1,118 @@
+package ginpow
+
+import (
+	"context"
+	"math/bits"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// resultContextKey is the key the result of a verification is set in gin.Context and request contexts
+const resultContextKey = "ginpow.result"
+
+// VerificationResult is the result of verifying the proof of a request, set in the
+// context by VerifyNonceMiddleware for the next handlers. See Result and ResultFromContext.
+type VerificationResult struct {
+	// Passed reports whether the proof was verified. It is only false in `ReportOnly`
+	//   mode, for a failed verification that isn't enforced, which is set in Err.
+	Passed bool
+	Err    *VerificationError
+
+	// Clearance reports whether the request was let through by a clearance token instead
+	//   of a proof, see `Middleware.Clearance`. Only Scope and VerifyTime are then set.
+	Clearance bool
+
+	Nonce string
+
+	// Difficulty is the difficulty required of the proof.
+	Difficulty int
+
+	// LeadingZeroBits is the number of leading zero bits of the hash, which is the
+	//   difficulty the client actually met. See ExcessBits.
+	LeadingZeroBits int
+
+	// Algorithm and AlgorithmParams are the name and parameters of `Middleware.Algorithm`,
+	//   or `sha256` if the default hash is used. Empty for a custom `Middleware.Hash`.
+	Algorithm       string
+	AlgorithmParams string
+
+	// Scope is the scope the nonce was bound to, if any. See `Middleware.Scopes`.
+	Scope string
+
+	// IssuedAt is when the nonce was issued, if it is embedded in the nonce, which it is
+	//   when `Middleware.ChallengeTTL` is set.
+	IssuedAt time.Time
+
+	// SolveTime is how long after it was issued the nonce was presented, zero if IssuedAt is unknown.
+	SolveTime time.Duration
+
+	// VerifyTime is how long the verification took.
+	VerifyTime time.Duration
+}
+
+// ExcessBits is how many leading zero bits more than required the hash has. Each bit
+// doubles the work expected of the client.
+func (res *VerificationResult) ExcessBits() int {
+	if res.LeadingZeroBits < res.Difficulty {
+		return 0
+	}
+	return res.LeadingZeroBits - res.Difficulty
+}
+
+// Result returns the result of the verification set in the context by VerifyNonceMiddleware.
+func Result(c *gin.Context) (*VerificationResult, bool) {
+	v, exists := c.Get(resultContextKey)
+	if !exists {
+		return nil, false
+	}
+
+	res, ok := v.(*VerificationResult)
+	return res, ok
+}
+
+// ResultFromContext returns the result of the verification set in a request context by
+// HTTPMiddleware.VerifyNonceMiddleware.
+func ResultFromContext(ctx context.Context) (*VerificationResult, bool) {
+	res, ok := ctx.Value(contextKey(resultContextKey)).(*VerificationResult)
+	return res, ok
+}
+
+// withResult returns a copy of ctx with the result of a verification
+func withResult(ctx context.Context, res *VerificationResult) context.Context {
+	return context.WithValue(ctx, contextKey(resultContextKey), res)
+}
+
+// failedResult is the result of a failed verification started at start that isn't enforced
+func failedResult(start time.Time, err *VerificationError) *VerificationResult {
+	return &VerificationResult{
+		Err:        err,
+		Nonce:      err.Nonce,
+		Difficulty: err.Difficulty,
+		VerifyTime: time.Since(start),
+	}
+}
+
+// algorithmName is the name and parameters of the hash algorithm proofs are verified with
+func (pow *Middleware) algorithmName() (string, string) {
+	if pow.Algorithm != nil {
+		return pow.Algorithm.Name(), pow.Algorithm.Params()
+	}
+
+	if pow.Hash == nil {
+		return SHA256{}.Name(), ""
+	}
+	return "", ""
+}
+
+// leadingZeroBits counts the leading zero bits of a hash
+func leadingZeroBits(hash []byte) int {
+	n := 0
+	for _, b := range hash {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
@@ -0,0 +1,146 @@
+package ginpow
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// solve returns data prefixed with a counter whose hash with nonce has at least difficulty leading zero bits
+func solve(data, nonce string, difficulty int) (string, string) {
+	for i := 0; ; i++ {
+		d := strconv.Itoa(i) + data
+		sum := sha256.Sum256([]byte(d + nonce))
+		if leadingZeroBits(sum[:]) >= difficulty {
+			return d, hex.EncodeToString(sum[:])
+		}
+	}
+}
+
+func TestLeadingZeroBits(t *testing.T) {
+	tests := []struct {
+		hash   []byte
+		expect int
+	}{
+		{[]byte{0xff}, 0},
+		{[]byte{0x01}, 7},
+		{[]byte{0x00, 0x10}, 11},
+		{[]byte{0x00, 0x00}, 16},
+	}
+
+	for _, tt := range tests {
+		if got := leadingZeroBits(tt.hash); got != tt.expect {
+			t.Errorf("leadingZeroBits(%x); Got: %v, Expected: %v", tt.hash, got, tt.expect)
+		}
+	}
+}
+
+func TestResult(t *testing.T) {
+	now := withTimeNow(t, time.Unix(1600000000, 0))
+
+	m, _ := New(&Middleware{
+		ExtractData:  func(c *gin.Context) (string, error) { return "", nil },
+		Check:        true,
+		Difficulty:   8,
+		ChallengeTTL: time.Minute,
+		Scopes:       []string{"GET /"},
+	})
+
+	nonce, nonceChecksum, _ := m.generateNonce(-1, "GET /", "", SourceGenerateNonce)
+	data, hash := solve("data", nonce, 8)
+	*now = now.Add(5 * time.Second)
+
+	m.ExtractData = func(c *gin.Context) (string, error) { return data, nil }
+	m.ExtractNonce = func(c *gin.Context) (string, string, error) { return nonce, nonceChecksum, nil }
+	m.ExtractHash = func(c *gin.Context) (string, error) { return hash, nil }
+
+	var res *VerificationResult
+	var ok bool
+
+	r := gin.New()
+	r.GET("/", m.VerifyNonceMiddleware, func(c *gin.Context) {
+		res, ok = Result(c)
+	})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if !ok {
+		t.Fatal("no result in context")
+	}
+
+	sum, _ := hex.DecodeString(hash)
+	if !res.Passed || res.Err != nil || res.Nonce != nonce || res.Difficulty != 8 || res.LeadingZeroBits != leadingZeroBits(sum) {
+		t.Errorf("unexpected result: %+v", res)
+	}
+
+	if res.ExcessBits() != res.LeadingZeroBits-8 {
+		t.Errorf("ExcessBits(); Got: %v, Expected: %v", res.ExcessBits(), res.LeadingZeroBits-8)
+	}
+
+	if res.Algorithm != "sha256" || res.Scope != "GET /" {
+		t.Errorf("unexpected algorithm or scope: %v %v", res.Algorithm, res.Scope)
+	}
+
+	if !res.IssuedAt.Equal(time.Unix(1600000000, 0)) || res.SolveTime != 5*time.Second {
+		t.Errorf("unexpected timing; issued at: %v, solve time: %v", res.IssuedAt, res.SolveTime)
+	}
+
+	t.Run("no result", func(t *testing.T) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+
+		if _, ok := Result(c); ok {
+			t.Error("Result() found a result in an unverified context")
+		}
+	})
+
+	t.Run("report only", func(t *testing.T) {
+		withRandIntn(t, 0)
+
+		m, _ := New(&Middleware{
+			ExtractData: func(c *gin.Context) (string, error) { return "data", nil },
+			ReportOnly:  true,
+		})
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/", nil)
+		m.VerifyNonceMiddleware(c)
+
+		res, ok := Result(c)
+		if !ok || res.Passed || res.Err == nil || res.Err.Code != ReasonMissingNonce {
+			t.Errorf("unexpected result: %+v", res)
+		}
+	})
+}
+
+func TestResultFromContext(t *testing.T) {
+	m, _ := NewHTTP(&HTTPMiddleware{
+		Middleware:  &Middleware{Difficulty: 4, Algorithm: SHA256{}},
+		ExtractData: func(r *http.Request) (string, error) { return "", nil },
+	})
+
+	data, hash := solve("data", "nonce", 4)
+	m.ExtractData = func(r *http.Request) (string, error) { return data, nil }
+	m.ExtractNonce = func(r *http.Request) (string, string, error) { return "nonce", "", nil }
+	m.ExtractHash = func(r *http.Request) (string, error) { return hash, nil }
+
+	var res *VerificationResult
+	var ok bool
+	h := m.VerifyNonceMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res, ok = ResultFromContext(r.Context())
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if !ok || !res.Passed || res.Difficulty != 4 || res.LeadingZeroBits < 4 || res.Algorithm != "sha256" {
+		t.Errorf("unexpected result: %+v", res)
+	}
+
+	if !res.IssuedAt.IsZero() || res.SolveTime != 0 {
+		t.Errorf("timing set for a nonce without an issue time: %+v", res)
+	}
+}
@@ -0,0 +1,71 @@
+package ginpow
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// scopeQueryParam is the query parameter a client can request the scope of a nonce with
+const scopeQueryParam = "scope"
+
+// scopeAllowed reports whether a client can request a nonce bound to scope
+func (pow *Middleware) scopeAllowed(scope string) bool {
+	for _, s := range pow.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// requestedScope returns the scope requested by a client on the `NonceScopeHeader`
+// header or the `scope` query parameter, or routeScope if none is requested.
+// It returns a badRequestError if the scope is not in `Scopes`.
+func (pow *Middleware) requestedScope(r *http.Request, routeScope string) (string, error) {
+	scope := routeScope
+	if r != nil {
+		if s := r.Header.Get(pow.NonceScopeHeader); s != "" {
+			scope = s
+		} else if s := r.URL.Query().Get(scopeQueryParam); s != "" {
+			scope = s
+		}
+	}
+
+	if !pow.scopeAllowed(scope) {
+		return "", badRequestError{ReasonScopeMismatch, "scope " + scope + " is not allowed"}
+	}
+	return scope, nil
+}
+
+// issueScope is the scope a nonce issued for a request is bound to, or "" if `Scopes` is not set
+func (pow *Middleware) issueScope(c *gin.Context) (string, error) {
+	if len(pow.Scopes) == 0 {
+		return "", nil
+	}
+	return pow.requestedScope(c.Request, pow.ScopeFunc(c))
+}
+
+// routeScope is the scope a proof presented to a request must be bound to, or "" if `Scopes` is not set
+func (pow *Middleware) routeScope(c *gin.Context) string {
+	if len(pow.Scopes) == 0 {
+		return ""
+	}
+	return pow.ScopeFunc(c)
+}
+
+// issueScope is the scope a nonce issued for a request is bound to, or "" if `Scopes` is not set
+func (pow *HTTPMiddleware) issueScope(r *http.Request) (string, error) {
+	if len(pow.Scopes) == 0 {
+		return "", nil
+	}
+	return pow.requestedScope(r, pow.ScopeFunc(r))
+}
+
+// routeScope is the scope a proof presented to a request must be bound to, or "" if `Scopes` is not set
+func (pow *HTTPMiddleware) routeScope(r *http.Request) string {
+	if len(pow.Scopes) == 0 {
+		return ""
+	}
+	return pow.ScopeFunc(r)
+}
@@ -0,0 +1,174 @@
+package ginpow
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestChallenge_scope(t *testing.T) {
+	nonce := challenge{scope: "GET /files/:name.json", hasScope: true}.encode("n")
+
+	ch, err := parseChallenge(nonce)
+	if err != nil {
+		t.Fatalf("parseChallenge() returned error: %v", err)
+	}
+
+	if !ch.hasScope || ch.scope != "GET /files/:name.json" {
+		t.Errorf("parsed scope; Got: %v, Expected: GET /files/:name.json", ch.scope)
+	}
+
+	if _, err := parseChallenge("n.s!"); err != ErrChallengeMalformed {
+		t.Errorf("parseChallenge() with bad scope = %v, want %v", err, ErrChallengeMalformed)
+	}
+}
+
+func TestMiddleware_Scopes(t *testing.T) {
+	t.Run("requires check", func(t *testing.T) {
+		_, err := New(&Middleware{
+			ExtractData: func(c *gin.Context) (string, error) { return "", nil },
+			Scopes:      []string{"POST /login"},
+		})
+
+		if err == nil {
+			t.Error("New() did not error when Scopes is set without Check")
+		}
+	})
+
+	m, _ := New(&Middleware{
+		ExtractData: func(c *gin.Context) (string, error) { return "data", nil },
+		Check:       true,
+		Scopes:      []string{"POST /login", "GET /nonce", "comments"},
+	})
+
+	r := gin.New()
+	r.GET("/nonce", m.NonceHandler)
+	r.POST("/login", m.VerifyNonceMiddleware, func(c *gin.Context) { c.Status(200) })
+	r.POST("/search", m.VerifyNonceMiddleware, func(c *gin.Context) { c.Status(200) })
+
+	// issue requests a nonce with the given scope header
+	issue := func(scope string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		req := httptest.NewRequest("GET", "/nonce", nil)
+		req.Header.Set("Accept", gin.MIMEJSON)
+		if scope != "" {
+			req.Header.Set("X-Nonce-Scope", scope)
+		}
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var j map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &j)
+		return w, j
+	}
+
+	// verify presents a solved nonce to path
+	verify := func(j map[string]interface{}, path string) int {
+		nonce := j["nonce"].(string)
+		sum := sha256.Sum256([]byte("data" + nonce))
+
+		req := httptest.NewRequest("POST", path, nil)
+		req.Header.Set("X-Nonce", nonce)
+		req.Header.Set("X-Nonce-Checksum", j["nonce_checksum"].(string))
+		req.Header.Set("X-Hash", hex.EncodeToString(sum[:]))
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	t.Run("requested scope", func(t *testing.T) {
+		_, j := issue("POST /login")
+
+		if j["scope"] != "POST /login" {
+			t.Errorf("scope; Got: %v, Expected: POST /login", j["scope"])
+		}
+
+		if code := verify(j, "/login"); code != 200 {
+			t.Errorf("proof presented to its scope returned %v", code)
+		}
+	})
+
+	t.Run("requested scope in query", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/nonce?scope=comments", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var j map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &j)
+
+		if j["scope"] != "comments" {
+			t.Errorf("scope; Got: %v, Expected: comments", j["scope"])
+		}
+	})
+
+	t.Run("defaults to issuing route", func(t *testing.T) {
+		_, j := issue("")
+
+		if j["scope"] != "GET /nonce" {
+			t.Errorf("scope; Got: %v, Expected: GET /nonce", j["scope"])
+		}
+	})
+
+	t.Run("scope not allowed", func(t *testing.T) {
+		w, _ := issue("POST /search")
+
+		if w.Code != 400 {
+			t.Errorf("nonce for scope not in allowlist returned %v, expected 400", w.Code)
+		}
+	})
+
+	t.Run("presented to another route", func(t *testing.T) {
+		_, j := issue("POST /login")
+
+		if code := verify(j, "/search"); code != 428 {
+			t.Errorf("proof presented to another scope returned %v, expected 428", code)
+		}
+	})
+
+	t.Run("nonce without scope", func(t *testing.T) {
+		unscoped, _ := New(&Middleware{
+			ExtractData: func(c *gin.Context) (string, error) { return "data", nil },
+			Check:       true,
+			Secret:      m.Secret,
+		})
+		nonce, nonceChecksum, _ := unscoped.generateNonce(-1, "", "", SourceGenerateNonce)
+
+		if code := verify(map[string]interface{}{"nonce": nonce, "nonce_checksum": nonceChecksum}, "/login"); code != 428 {
+			t.Errorf("proof without scope returned %v, expected 428", code)
+		}
+	})
+}
+
+func TestHTTPMiddleware_Scopes(t *testing.T) {
+	m, _ := NewHTTP(&HTTPMiddleware{
+		Middleware: &Middleware{
+			Check:  true,
+			Scopes: []string{"POST /login"},
+		},
+		ExtractData: func(r *http.Request) (string, error) { return "data", nil },
+	})
+
+	nonce, nonceChecksum, _ := m.generateNonce(-1, "POST /login", "", SourceGenerateNonce)
+	sum := sha256.Sum256([]byte("data" + nonce))
+
+	handler := m.VerifyNonceMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for path, expect := range map[string]int{"/login": 200, "/search": 428} {
+		req := httptest.NewRequest("POST", path, nil)
+		req.Header.Set("X-Nonce", nonce)
+		req.Header.Set("X-Nonce-Checksum", nonceChecksum)
+		req.Header.Set("X-Hash", hex.EncodeToString(sum[:]))
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != expect {
+			t.Errorf("proof presented to %v returned %v, expected %v", path, w.Code, expect)
+		}
+	}
+}
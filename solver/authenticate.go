@@ -0,0 +1,151 @@
+package solver
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	ginpow "github.com/jeongy-cho/gin-pow"
+)
+
+// ErrNoChallenge is returned by ParseWWWAuthenticate when the header has no PoW challenge.
+var ErrNoChallenge = errors.New("no PoW challenge in header")
+
+// ParseWWWAuthenticate reads the challenge from a `WWW-Authenticate` header set by a
+// ginpow.Middleware with ChallengeOnFailure, e.g.
+//
+//	PoW nonce="...", checksum="...", difficulty=12
+//
+// Challenges of other schemes in the header are skipped.
+func ParseWWWAuthenticate(header string) (Challenge, error) {
+	p := &authParser{s: header}
+
+	for {
+		scheme := p.token()
+		if scheme == "" {
+			return Challenge{}, ErrNoChallenge
+		}
+
+		params, err := p.params()
+		if err != nil {
+			return Challenge{}, err
+		}
+
+		if strings.EqualFold(scheme, ginpow.ChallengeScheme) {
+			return challengeFromParams(params)
+		}
+	}
+}
+
+// challengeFromParams builds a challenge from the auth params of a PoW challenge
+func challengeFromParams(params map[string]string) (Challenge, error) {
+	ch := Challenge{
+		Nonce:     params[ginpow.ChallengeParamNonce],
+		Checksum:  params[ginpow.ChallengeParamChecksum],
+		Algorithm: params[ginpow.ChallengeParamAlgorithm],
+		Params:    params[ginpow.ChallengeParamParams],
+	}
+
+	if ch.Nonce == "" {
+		return Challenge{}, errors.New("PoW challenge has no nonce")
+	}
+
+	difficulty, err := strconv.Atoi(params[ginpow.ChallengeParamDifficulty])
+	if err != nil {
+		return Challenge{}, fmt.Errorf("invalid PoW challenge difficulty: %v", err)
+	}
+	ch.Difficulty = difficulty
+
+	return ch, nil
+}
+
+// authParser reads the challenges of a `WWW-Authenticate` header
+type authParser struct {
+	s   string
+	pos int
+}
+
+// skip skips whitespace and commas
+func (p *authParser) skip() {
+	for p.pos < len(p.s) && strings.IndexByte(" \t,", p.s[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+// token reads a token, or returns "" if there is none
+func (p *authParser) token() string {
+	p.skip()
+
+	start := p.pos
+	for p.pos < len(p.s) && strings.IndexByte(" \t,=\"", p.s[p.pos]) < 0 {
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+// params reads the auth params of a challenge, stopping before the scheme of the next one
+func (p *authParser) params() (map[string]string, error) {
+	params := make(map[string]string)
+
+	for {
+		start := p.pos
+		name := p.token()
+		if name == "" {
+			return params, nil
+		}
+
+		for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+			p.pos++
+		}
+
+		if p.pos >= len(p.s) || p.s[p.pos] != '=' {
+			// the name is the scheme of the next challenge
+			p.pos = start
+			return params, nil
+		}
+		p.pos++
+
+		for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+			p.pos++
+		}
+
+		if p.pos < len(p.s) && p.s[p.pos] == '"' {
+			value, err := p.quoted()
+			if err != nil {
+				return nil, err
+			}
+			params[strings.ToLower(name)] = value
+			continue
+		}
+
+		params[strings.ToLower(name)] = p.token()
+
+		// skip the padding of a token68
+		for p.pos < len(p.s) && p.s[p.pos] == '=' {
+			p.pos++
+		}
+	}
+}
+
+// quoted reads a quoted-string
+func (p *authParser) quoted() (string, error) {
+	var b strings.Builder
+
+	for p.pos++; p.pos < len(p.s); p.pos++ {
+		switch c := p.s[p.pos]; c {
+		case '"':
+			p.pos++
+			return b.String(), nil
+		case '\\':
+			p.pos++
+			if p.pos < len(p.s) {
+				b.WriteByte(p.s[p.pos])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return "", errors.New("unterminated quoted string in header")
+}
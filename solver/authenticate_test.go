@@ -0,0 +1,48 @@
+package solver_test
+
+import (
+	"testing"
+
+	"github.com/jeongy-cho/gin-pow/solver"
+)
+
+func TestParseWWWAuthenticate(t *testing.T) {
+	t.Run("challenge", func(t *testing.T) {
+		ch, err := solver.ParseWWWAuthenticate(`PoW nonce="n\"1", checksum="abc", difficulty=12, expires=1600000060, alg="scrypt", params="n=16,r=1,p=1,l=32"`)
+		if err != nil {
+			t.Fatalf("ParseWWWAuthenticate() returned error: %v", err)
+		}
+
+		expect := solver.Challenge{Nonce: `n"1`, Checksum: "abc", Difficulty: 12, Algorithm: "scrypt", Params: "n=16,r=1,p=1,l=32"}
+		if ch != expect {
+			t.Errorf("ParseWWWAuthenticate(); Got: %+v, Expected: %+v", ch, expect)
+		}
+	})
+
+	t.Run("skips other schemes", func(t *testing.T) {
+		ch, err := solver.ParseWWWAuthenticate(`Basic realm="x, y", Bearer abc==, pow nonce=n, difficulty=3`)
+		if err != nil {
+			t.Fatalf("ParseWWWAuthenticate() returned error: %v", err)
+		}
+
+		if ch.Nonce != "n" || ch.Difficulty != 3 {
+			t.Errorf("unexpected challenge: %+v", ch)
+		}
+	})
+
+	t.Run("no challenge", func(t *testing.T) {
+		for _, h := range []string{"", `Basic realm="x"`} {
+			if _, err := solver.ParseWWWAuthenticate(h); err != solver.ErrNoChallenge {
+				t.Errorf("ParseWWWAuthenticate(%q); Got: %v, Expected: %v", h, err, solver.ErrNoChallenge)
+			}
+		}
+	})
+
+	t.Run("invalid challenge", func(t *testing.T) {
+		for _, h := range []string{`PoW difficulty=3`, `PoW nonce="n", difficulty=x`, `PoW nonce="n`} {
+			if _, err := solver.ParseWWWAuthenticate(h); err == nil || err == solver.ErrNoChallenge {
+				t.Errorf("ParseWWWAuthenticate(%q) did not return an invalid challenge error: %v", h, err)
+			}
+		}
+	})
+}
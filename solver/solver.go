@@ -0,0 +1,177 @@
+// Package solver solves proof of work nonces issued by a ginpow.Middleware.
+//
+// A solution is found by appending a counter to the data string until
+// Hash(data + counter + nonce) has at least the required number of leading
+// zero bits. The server's ExtractData must therefore return the data followed
+// by the counter, e.g. the `counter` field in the example.
+package solver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/bits"
+	"runtime"
+	"strconv"
+	"sync"
+
+	ginpow "github.com/jeongy-cho/gin-pow"
+	gopow "github.com/jeongy-cho/go-pow/v2"
+)
+
+// Challenge is a nonce as returned by ginpow.Middleware.NonceHandler.
+type Challenge struct {
+	Nonce      string `json:"nonce" xml:"nonce"`
+	Checksum   string `json:"nonce_checksum,omitempty" xml:"nonce_checksum,omitempty"`
+	Difficulty int    `json:"difficulty" xml:"difficulty"`
+
+	// Algorithm and Params are the advertised hash algorithm, if any.
+	Algorithm string `json:"algorithm,omitempty" xml:"algorithm,omitempty"`
+	Params    string `json:"algorithm_params,omitempty" xml:"algorithm_params,omitempty"`
+}
+
+// Solution is a solved challenge.
+type Solution struct {
+	// Counter is the counter that was appended to the data.
+	Counter uint64
+
+	// Data is the data followed by the counter. This is what the server must extract.
+	Data string
+
+	// Hash is the hex encoded hash to submit.
+	Hash string
+}
+
+// ErrUnsolvable is returned when the difficulty exceeds the hash size.
+var ErrUnsolvable = errors.New("difficulty exceeds hash size")
+
+// checkInterval is how many hashes a worker computes between checking for cancellation
+const checkInterval = 1024
+
+// Solver finds solutions to challenges using multiple goroutines.
+type Solver struct {
+	// Hash function for proof of work. Must match the server's `Middleware.Hash`.
+	//   Defaults to the challenge's advertised algorithm, or sha256
+	Hash gopow.HashFunction
+
+	// Workers is the number of goroutines used to search.
+	//   Defaults to runtime.NumCPU()
+	Workers int
+}
+
+// Solve finds a solution to ch for data using all CPU cores.
+func Solve(ctx context.Context, ch Challenge, data string, hash gopow.HashFunction) (*Solution, error) {
+	s := &Solver{Hash: hash}
+	return s.Solve(ctx, ch, data)
+}
+
+// Solve finds a solution to ch for data. It returns ctx.Err() if ctx is done first.
+func (s *Solver) Solve(ctx context.Context, ch Challenge, data string) (*Solution, error) {
+	hash, err := hashFor(ch, s.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	if ch.Difficulty > len(hash(nil))*8 {
+		return nil, ErrUnsolvable
+	}
+
+	workers := s.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		once     sync.Once
+		solution *Solution
+		wg       sync.WaitGroup
+	)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(counter uint64) {
+			defer wg.Done()
+
+			for n := 0; ; n++ {
+				if n%checkInterval == 0 && ctx.Err() != nil {
+					return
+				}
+
+				d := data + strconv.FormatUint(counter, 10)
+				h := hash([]byte(d + ch.Nonce))
+				if LeadingZeroBits(h) >= ch.Difficulty {
+					once.Do(func() {
+						solution = &Solution{
+							Counter: counter,
+							Data:    d,
+							Hash:    hex.EncodeToString(h),
+						}
+						cancel()
+					})
+					return
+				}
+
+				counter += uint64(workers)
+			}
+		}(uint64(i))
+	}
+	wg.Wait()
+
+	if solution == nil {
+		return nil, ctx.Err()
+	}
+	return solution, nil
+}
+
+// Verify reports whether hash is a valid solution to ch for data.
+func Verify(ch Challenge, data string, hash string, hashFunc gopow.HashFunction) bool {
+	hashFunc, err := hashFor(ch, hashFunc)
+	if err != nil {
+		return false
+	}
+
+	b, err := hex.DecodeString(hash)
+	if err != nil {
+		return false
+	}
+
+	return hex.EncodeToString(hashFunc([]byte(data+ch.Nonce))) == hash && LeadingZeroBits(b) >= ch.Difficulty
+}
+
+// LeadingZeroBits returns the number of leading zero bits in b.
+func LeadingZeroBits(b []byte) int {
+	var n int
+	for _, c := range b {
+		if c != 0 {
+			return n + bits.LeadingZeros8(c)
+		}
+		n += 8
+	}
+	return n
+}
+
+// hashFor returns hash, or the algorithm advertised by ch if hash is nil
+func hashFor(ch Challenge, hash gopow.HashFunction) (gopow.HashFunction, error) {
+	if hash != nil {
+		return hash, nil
+	}
+
+	if ch.Algorithm == "" {
+		return sha256Hash, nil
+	}
+
+	alg, err := ginpow.ParseHashAlgorithm(ch.Algorithm, ch.Params)
+	if err != nil {
+		return nil, err
+	}
+	return alg.Sum, nil
+}
+
+func sha256Hash(b []byte) []byte {
+	sum := sha256.Sum256(b)
+	return sum[:]
+}
@@ -0,0 +1,143 @@
+package solver_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	ginpow "github.com/jeongy-cho/gin-pow"
+	"github.com/jeongy-cho/gin-pow/solver"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	m.Run()
+}
+
+func TestSolve(t *testing.T) {
+	t.Run("solves middleware nonce", func(t *testing.T) {
+		var data string
+		m, _ := ginpow.New(&ginpow.Middleware{
+			Check:       true,
+			Difficulty:  12,
+			ExtractData: func(c *gin.Context) (string, error) { return data, nil },
+		})
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Accepted = []string{gin.MIMEJSON}
+		m.NonceHandler(c)
+
+		var ch solver.Challenge
+		if err := json.Unmarshal(w.Body.Bytes(), &ch); err != nil {
+			t.Fatalf("could not decode challenge: %v", err)
+		}
+
+		s, err := solver.Solve(context.Background(), ch, "payload", nil)
+		if err != nil {
+			t.Fatalf("Solve() returned error: %v", err)
+		}
+
+		if !solver.Verify(ch, s.Data, s.Hash, nil) {
+			t.Errorf("solution does not verify: %+v", s)
+		}
+
+		data = s.Data
+		m.ExtractNonce = func(c *gin.Context) (string, string, error) { return ch.Nonce, ch.Checksum, nil }
+		m.ExtractHash = func(c *gin.Context) (string, error) { return s.Hash, nil }
+
+		w = httptest.NewRecorder()
+		c, _ = gin.CreateTestContext(w)
+		m.VerifyNonceMiddleware(c)
+
+		if len(c.Errors) > 0 {
+			t.Errorf("verification failed with error: %v", c.Errors)
+		}
+	})
+
+	t.Run("solves advertised algorithm", func(t *testing.T) {
+		var data string
+		m, _ := ginpow.New(&ginpow.Middleware{
+			Check:       true,
+			Difficulty:  4,
+			Algorithm:   ginpow.Scrypt{N: 16, R: 1},
+			ExtractData: func(c *gin.Context) (string, error) { return data, nil },
+		})
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Accepted = []string{gin.MIMEJSON}
+		m.NonceHandler(c)
+
+		var ch solver.Challenge
+		if err := json.Unmarshal(w.Body.Bytes(), &ch); err != nil {
+			t.Fatalf("could not decode challenge: %v", err)
+		}
+
+		if ch.Algorithm != "scrypt" {
+			t.Fatalf("challenge algorithm; Got: %v, Expected: scrypt", ch.Algorithm)
+		}
+
+		s, err := solver.Solve(context.Background(), ch, "payload", nil)
+		if err != nil {
+			t.Fatalf("Solve() returned error: %v", err)
+		}
+
+		data = s.Data
+		m.ExtractNonce = func(c *gin.Context) (string, string, error) { return ch.Nonce, ch.Checksum, nil }
+		m.ExtractHash = func(c *gin.Context) (string, error) { return s.Hash, nil }
+
+		w = httptest.NewRecorder()
+		c, _ = gin.CreateTestContext(w)
+		m.VerifyNonceMiddleware(c)
+
+		if len(c.Errors) > 0 {
+			t.Errorf("verification failed with error: %v", c.Errors)
+		}
+	})
+
+	t.Run("unknown algorithm", func(t *testing.T) {
+		_, err := solver.Solve(context.Background(), solver.Challenge{Nonce: "nonce", Algorithm: "md5"}, "", nil)
+		if err == nil {
+			t.Error("Solve() did not error on unknown algorithm")
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		s := &solver.Solver{Workers: 2}
+		_, err := s.Solve(ctx, solver.Challenge{Nonce: "nonce", Difficulty: 200}, "")
+		if err != context.DeadlineExceeded {
+			t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+		}
+	})
+
+	t.Run("unsolvable", func(t *testing.T) {
+		_, err := solver.Solve(context.Background(), solver.Challenge{Nonce: "nonce", Difficulty: 257}, "", nil)
+		if err != solver.ErrUnsolvable {
+			t.Errorf("expected %v, got %v", solver.ErrUnsolvable, err)
+		}
+	})
+}
+
+func TestLeadingZeroBits(t *testing.T) {
+	tests := []struct {
+		b    []byte
+		want int
+	}{
+		{[]byte{0x80}, 0},
+		{[]byte{0x02, 0xff}, 6},
+		{[]byte{0x00, 0x01}, 15},
+		{[]byte{0x00, 0x00}, 16},
+	}
+	for _, tt := range tests {
+		if got := solver.LeadingZeroBits(tt.b); got != tt.want {
+			t.Errorf("LeadingZeroBits(%x) = %v, want %v", tt.b, got, tt.want)
+		}
+	}
+}
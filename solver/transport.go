@@ -0,0 +1,277 @@
+package solver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	ginpow "github.com/jeongy-cho/gin-pow"
+)
+
+// Transport is an http.RoundTripper that solves proof of work challenges. When a
+// response has the `FailureStatusCode`, or is the 400 a ginpow.Middleware without
+// ChallengeOnFailure answers a request without a nonce with, it reads a challenge from
+// the `WWW-Authenticate` header set by ginpow.Middleware with ChallengeOnFailure, or the
+// response headers set by ginpow.Middleware.NonceHeaderMiddleware, or fetches one from
+// `NonceURL`, solves it, and retries the request once with the solution attached.
+//
+// By default the challenge is solved against BodyDigest, which the default ginpow
+// ExtractData rebuilds from the request, and only the counter is sent on `CounterHeader`.
+// When `Data` is set, the solved data is also sent on `DataHeader` unless `OmitData` is
+// set, so the server's ExtractData may either return the data header, or rebuild the
+// data from the request itself, as ginpow.Middleware.ExtractCanonicalJSON does when it
+// is set to CanonicalJSON.
+type Transport struct {
+	// Base is the underlying RoundTripper.
+	//   Defaults to http.DefaultTransport
+	Base http.RoundTripper
+
+	// Solver solves challenges.
+	//   Defaults to a Solver using sha256 and all CPU cores.
+	Solver *Solver
+
+	// NonceURL is the url of a ginpow.Middleware.NonceHandler to fetch a challenge from
+	//   when the failed response does not carry one in its headers.
+	//   Optional.
+	NonceURL string
+
+	// Data returns the data to solve against for a request. body is the buffered request body.
+	//   Defaults to BodyDigest, with the data omitted, for servers using the default ginpow
+	//   ExtractData. Set it to CanonicalJSON, with `OmitData`, for servers using
+	//   ginpow.Middleware.ExtractCanonicalJSON.
+	Data func(req *http.Request, body []byte) (string, error)
+
+	// OmitData skips sending the solved data on `DataHeader`, for servers that rebuild it
+	//   from the request. Only the counter is sent on `CounterHeader`.
+	//   Defaults to false, and is implied when `Data` is not set. Set it with CanonicalJSON,
+	//   as the canonical JSON of a body is as large as the body itself.
+	OmitData bool
+
+	// the following are the headers challenges are read from and solutions are sent on.
+	// Defaults:
+	//   NonceHeader:          "X-Nonce"
+	//   NonceChecksumHeader:  "X-Nonce-Checksum"
+	//   HashDifficultyHeader: "X-Hash-Difficulty"
+	//   HashHeader:           "X-Hash"
+	//   DataHeader:           "X-Hash-Data"
+	//   CounterHeader:        "X-Hash-Counter"
+	//   HashAlgorithmHeader:  "X-Hash-Algorithm"
+	//   HashParamsHeader:     "X-Hash-Params"
+	NonceHeader          string
+	NonceChecksumHeader  string
+	HashDifficultyHeader string
+	HashHeader           string
+	DataHeader           string
+	CounterHeader        string
+	HashAlgorithmHeader  string
+	HashParamsHeader     string
+
+	// FailureStatusCode is the status code that triggers solving, besides the 400 of a
+	//   request without a nonce.
+	//   Defaults to 428.
+	FailureStatusCode int
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	res, err := t.base().RoundTrip(withBody(req, body))
+	if err != nil || res.StatusCode != t.failureStatusCode() && !missingNonce(res) {
+		return res, err
+	}
+
+	ch, ok, err := t.challenge(req, res)
+	if err != nil {
+		drain(res)
+		return nil, err
+	}
+	if !ok {
+		return res, nil
+	}
+	drain(res)
+
+	data, omit := t.Data, t.OmitData
+	if data == nil {
+		data, omit = BodyDigest, true
+	}
+	solved, err := data(req, body)
+	if err != nil {
+		return nil, err
+	}
+
+	s := t.Solver
+	if s == nil {
+		s = &Solver{}
+	}
+	solution, err := s.Solve(req.Context(), ch, solved)
+	if err != nil {
+		return nil, err
+	}
+
+	retry := withBody(req, body)
+	retry.Header.Set(header(t.NonceHeader, "X-Nonce"), ch.Nonce)
+	if ch.Checksum != "" {
+		retry.Header.Set(header(t.NonceChecksumHeader, "X-Nonce-Checksum"), ch.Checksum)
+	}
+	retry.Header.Set(header(t.HashHeader, "X-Hash"), solution.Hash)
+	if !omit {
+		if strings.ContainsAny(solution.Data, "\r\n") {
+			return nil, fmt.Errorf("solved data can't be sent on the %v header, set OmitData", header(t.DataHeader, "X-Hash-Data"))
+		}
+		retry.Header.Set(header(t.DataHeader, "X-Hash-Data"), solution.Data)
+	}
+	retry.Header.Set(header(t.CounterHeader, "X-Hash-Counter"), strconv.FormatUint(solution.Counter, 10))
+
+	return t.base().RoundTrip(retry)
+}
+
+// BodyDigest returns the data the default ginpow ExtractData verifies a request against,
+// see ginpow.BodyDigest. It is the default `Transport.Data`.
+func BodyDigest(req *http.Request, body []byte) (string, error) {
+	return ginpow.BodyDigest(req.Method, req.URL.Path, body), nil
+}
+
+// CanonicalJSON returns a `Transport.Data` that solves against the ginpow.CanonicalJSON of
+// the request body, or of the given fields of it, for servers using
+// ginpow.Middleware.ExtractCanonicalJSON with the same fields. Use it with `Transport.OmitData`.
+func CanonicalJSON(fields ...string) func(req *http.Request, body []byte) (string, error) {
+	return func(req *http.Request, body []byte) (string, error) {
+		return ginpow.CanonicalJSON(body, fields...)
+	}
+}
+
+// challenge reads a challenge from a failed response, or fetches one from NonceURL
+func (t *Transport) challenge(req *http.Request, res *http.Response) (Challenge, bool, error) {
+	if authenticate := res.Header.Values("WWW-Authenticate"); len(authenticate) > 0 {
+		ch, err := ParseWWWAuthenticate(strings.Join(authenticate, ", "))
+		if err == nil {
+			return ch, true, nil
+		}
+
+		if err != ErrNoChallenge {
+			return Challenge{}, false, err
+		}
+	}
+
+	if nonce := res.Header.Get(header(t.NonceHeader, "X-Nonce")); nonce != "" {
+		difficulty, err := strconv.Atoi(res.Header.Get(header(t.HashDifficultyHeader, "X-Hash-Difficulty")))
+		if err != nil {
+			return Challenge{}, false, fmt.Errorf("invalid difficulty header: %v", err)
+		}
+
+		return Challenge{
+			Nonce:      nonce,
+			Checksum:   res.Header.Get(header(t.NonceChecksumHeader, "X-Nonce-Checksum")),
+			Difficulty: difficulty,
+			Algorithm:  res.Header.Get(header(t.HashAlgorithmHeader, "X-Hash-Algorithm")),
+			Params:     res.Header.Get(header(t.HashParamsHeader, "X-Hash-Params")),
+		}, true, nil
+	}
+
+	if t.NonceURL == "" {
+		return Challenge{}, false, nil
+	}
+
+	nonceReq, err := http.NewRequest("GET", t.NonceURL, nil)
+	if err != nil {
+		return Challenge{}, false, err
+	}
+	nonceReq = nonceReq.WithContext(req.Context())
+	nonceReq.Header.Set("Accept", "application/json")
+
+	nonceRes, err := t.base().RoundTrip(nonceReq)
+	if err != nil {
+		return Challenge{}, false, err
+	}
+	defer drain(nonceRes)
+
+	if nonceRes.StatusCode != http.StatusOK {
+		return Challenge{}, false, fmt.Errorf("nonce request returned status %v", nonceRes.StatusCode)
+	}
+
+	var ch Challenge
+	if err := json.NewDecoder(nonceRes.Body).Decode(&ch); err != nil {
+		return Challenge{}, false, err
+	}
+	return ch, true, nil
+}
+
+// missingNonce reports whether res is the rejection of a request without a nonce by a
+// ginpow.Middleware without ChallengeOnFailure, either as text or as problem details.
+// The read part of the body is put back in front of the rest.
+func missingNonce(res *http.Response) bool {
+	if res.StatusCode != http.StatusBadRequest {
+		return false
+	}
+
+	head, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+	res.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), res.Body), res.Body}
+
+	if strings.TrimSpace(string(head)) == ginpow.ErrMissingNonce.Error() {
+		return true
+	}
+
+	var problem struct {
+		Code string `json:"code"`
+	}
+	return json.Unmarshal(head, &problem) == nil && problem.Code == ginpow.ReasonMissingNonce
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+func (t *Transport) failureStatusCode() int {
+	if t.FailureStatusCode != 0 {
+		return t.FailureStatusCode
+	}
+	return 428
+}
+
+// withBody clones req with a fresh reader over body
+func withBody(req *http.Request, body []byte) *http.Request {
+	r := req.Clone(req.Context())
+	if body == nil {
+		return r
+	}
+
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	r.ContentLength = int64(len(body))
+	return r
+}
+
+// drain reads and closes a response body so the connection can be reused
+func drain(res *http.Response) {
+	io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+}
+
+func header(name, def string) string {
+	if name != "" {
+		return name
+	}
+	return def
+}
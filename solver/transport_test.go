@@ -0,0 +1,240 @@
+package solver_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	ginpow "github.com/jeongy-cho/gin-pow"
+	"github.com/jeongy-cho/gin-pow/solver"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	m, err := ginpow.New(&ginpow.Middleware{Check: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := ginpow.New(&ginpow.Middleware{
+		Check:      true,
+		Difficulty: 8,
+		NonceStore: ginpow.NewMemoryNonceStore(0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	problem, err := ginpow.New(&ginpow.Middleware{
+		Check:          true,
+		Difficulty:     8,
+		ProblemDetails: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	challenge, err := ginpow.New(&ginpow.Middleware{
+		Check:              true,
+		Difficulty:         8,
+		ChallengeOnFailure: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	canonical, err := ginpow.New(&ginpow.Middleware{
+		Check:              true,
+		Difficulty:         8,
+		ChallengeOnFailure: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	canonical.ExtractData = canonical.ExtractCanonicalJSON("user.name", "amount")
+
+	r := gin.New()
+	r.GET("/nonce", m.NonceHandler)
+	r.POST("/handler", m.VerifyNonceMiddleware, echo)
+	r.GET("/stored/nonce", stored.NonceHandler)
+	r.POST("/headers", stored.NonceHeaderMiddleware, stored.VerifyNonceMiddleware, echo)
+	r.POST("/stored", stored.VerifyNonceMiddleware, echo)
+	r.GET("/problem/nonce", problem.NonceHandler)
+	r.POST("/problem", problem.VerifyNonceMiddleware, echo)
+	r.POST("/challenge", challenge.VerifyNonceMiddleware, echo)
+	r.POST("/canonical", canonical.VerifyNonceMiddleware, echo)
+
+	s := httptest.NewServer(r)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func echo(c *gin.Context) {
+	b, _ := ioutil.ReadAll(c.Request.Body)
+	c.Data(200, "text/plain", b)
+}
+
+func TestTransport(t *testing.T) {
+	s := newTestServer(t)
+
+	post := func(client *http.Client, path string) (int, string) {
+		res, err := client.Post(s.URL+path, "text/plain", bytes.NewBufferString("body"))
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer res.Body.Close()
+
+		b, _ := ioutil.ReadAll(res.Body)
+		return res.StatusCode, string(b)
+	}
+
+	t.Run("challenge from headers", func(t *testing.T) {
+		client := &http.Client{Transport: &solver.Transport{}}
+
+		code, body := post(client, "/headers")
+		if code != 200 {
+			t.Errorf("unexpected status; Got: %v, Expected: 200", code)
+		}
+
+		if body != "body" {
+			t.Errorf("request body not replayed; Got: %q", body)
+		}
+	})
+
+	t.Run("challenge from NonceURL", func(t *testing.T) {
+		client := &http.Client{Transport: &solver.Transport{NonceURL: s.URL + "/nonce"}}
+
+		if code, body := post(client, "/handler"); code != 200 || body != "body" {
+			t.Errorf("unexpected response; Got: %v %q", code, body)
+		}
+	})
+
+	t.Run("challenge from NonceURL, nonce store", func(t *testing.T) {
+		client := &http.Client{Transport: &solver.Transport{NonceURL: s.URL + "/stored/nonce"}}
+
+		if code, body := post(client, "/stored"); code != 200 || body != "body" {
+			t.Errorf("unexpected response; Got: %v %q", code, body)
+		}
+	})
+
+	t.Run("challenge from NonceURL, problem details", func(t *testing.T) {
+		client := &http.Client{Transport: &solver.Transport{NonceURL: s.URL + "/problem/nonce"}}
+
+		if code, body := post(client, "/problem"); code != 200 || body != "body" {
+			t.Errorf("unexpected response; Got: %v %q", code, body)
+		}
+	})
+
+	t.Run("challenge from WWW-Authenticate", func(t *testing.T) {
+		client := &http.Client{Transport: &solver.Transport{}}
+
+		if code, body := post(client, "/challenge"); code != 200 || body != "body" {
+			t.Errorf("unexpected response; Got: %v %q", code, body)
+		}
+	})
+
+	t.Run("body digest by default", func(t *testing.T) {
+		var dataHeader []string
+		record := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get("X-Hash") != "" {
+				dataHeader = req.Header.Values("X-Hash-Data")
+			}
+			return http.DefaultTransport.RoundTrip(req)
+		})
+		client := &http.Client{Transport: &solver.Transport{Base: record}}
+
+		if code, body := post(client, "/challenge"); code != 200 || body != "body" {
+			t.Errorf("unexpected response; Got: %v %q", code, body)
+		}
+
+		if dataHeader != nil {
+			t.Errorf("data sent with OmitData; Got: %q", dataHeader)
+		}
+	})
+
+	t.Run("body digest, tampered body", func(t *testing.T) {
+		tamper := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get("X-Hash") != "" {
+				req.Body = ioutil.NopCloser(bytes.NewBufferString("tampered"))
+				req.ContentLength = int64(len("tampered"))
+			}
+			return http.DefaultTransport.RoundTrip(req)
+		})
+		client := &http.Client{Transport: &solver.Transport{Base: tamper}}
+
+		if code, _ := post(client, "/challenge"); code != 428 {
+			t.Errorf("unexpected status; Got: %v, Expected: 428", code)
+		}
+	})
+
+	t.Run("canonical JSON", func(t *testing.T) {
+		client := &http.Client{Transport: &solver.Transport{Data: solver.CanonicalJSON("user.name", "amount"), OmitData: true}}
+		body := `{ "amount": 10.0, "user": {"name": "jane"} }`
+
+		res, err := client.Post(s.URL+"/canonical", "application/json", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer res.Body.Close()
+
+		if b, _ := ioutil.ReadAll(res.Body); res.StatusCode != 200 || string(b) != body {
+			t.Errorf("unexpected response; Got: %v %q", res.StatusCode, b)
+		}
+	})
+
+	t.Run("data with line breaks", func(t *testing.T) {
+		data := func(req *http.Request, body []byte) (string, error) { return "line\nbreak", nil }
+		client := &http.Client{Transport: &solver.Transport{Data: data}}
+
+		if _, err := client.Post(s.URL+"/headers", "text/plain", bytes.NewBufferString("body")); err == nil {
+			t.Error("request with line breaks in the data header did not error")
+		}
+	})
+
+	t.Run("invalid challenge", func(t *testing.T) {
+		body := &closeRecorder{Reader: bytes.NewBufferString("body")}
+		invalid := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			header := http.Header{}
+			header.Set("X-Nonce", "nonce")
+			header.Set("X-Hash-Difficulty", "x")
+			return &http.Response{StatusCode: 428, Header: header, Body: body}, nil
+		})
+		transport := &solver.Transport{Base: invalid}
+
+		res, err := transport.RoundTrip(httptest.NewRequest("POST", s.URL+"/handler", nil))
+		if err == nil || res != nil {
+			t.Errorf("RoundTrip(); Got: %v %v, Expected: nil and an error", res, err)
+		}
+
+		if !body.closed {
+			t.Error("response body of the failed challenge not closed")
+		}
+	})
+
+	t.Run("no challenge", func(t *testing.T) {
+		client := &http.Client{Transport: &solver.Transport{}}
+
+		if code, body := post(client, "/handler"); code != 400 || body != ginpow.ErrMissingNonce.Error() {
+			t.Errorf("unexpected response; Got: %v %q, Expected: 400 %q", code, body, ginpow.ErrMissingNonce.Error())
+		}
+	})
+}
+
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (r *closeRecorder) Close() error {
+	r.closed = true
+	return nil
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,126 @@
+package ginpow
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// sourceFunc extracts a value from a request
+type sourceFunc func(r *http.Request) (string, error)
+
+// parseSource parses a source spec of the form `kind:name` into a sourceFunc, e.g.
+// `header:X-Nonce`, `query:nonce`, `form:nonce`, `cookie:nonce` or `json:$.proof.nonce`
+func (pow *Middleware) parseSource(spec string) (sourceFunc, error) {
+	i := strings.Index(spec, ":")
+	if i < 0 || i == len(spec)-1 {
+		return nil, fmt.Errorf("source %q is not of the form kind:name", spec)
+	}
+	kind, name := spec[:i], spec[i+1:]
+
+	switch kind {
+	case "header":
+		return func(r *http.Request) (string, error) {
+			return r.Header.Get(name), nil
+		}, nil
+	case "query":
+		return func(r *http.Request) (string, error) {
+			return r.URL.Query().Get(name), nil
+		}, nil
+	case "form":
+		return func(r *http.Request) (string, error) {
+			return pow.formValue(r, name)
+		}, nil
+	case "cookie":
+		return func(r *http.Request) (string, error) {
+			cookie, err := r.Cookie(name)
+			if err != nil {
+				return "", nil
+			}
+			return cookie.Value, nil
+		}, nil
+	case "json":
+		path := jsonPath(name)
+		return func(r *http.Request) (string, error) {
+			return pow.jsonValue(r, path)
+		}, nil
+	}
+	return nil, fmt.Errorf("source %q has unknown kind %q", spec, kind)
+}
+
+// jsonPath converts a path like `$.items[0].id` to the dot separated path `items.0.id`
+func jsonPath(path string) string {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	return strings.NewReplacer("[", ".", "]", "").Replace(path)
+}
+
+// formValue returns a field of a url encoded or multipart form body, leaving the body
+// of the request unread for the next handlers
+func (pow *Middleware) formValue(r *http.Request, name string) (string, error) {
+	body, err := readBody(r, pow.MaxBodySize)
+	if err != nil {
+		return "", err
+	}
+
+	form := r.Clone(r.Context())
+	form.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return form.PostFormValue(name), nil
+}
+
+// jsonValue returns the value at a path of a JSON body. Strings are returned as is and
+// other values in their CanonicalJSON encoding. It returns an empty string for an empty
+// body or a missing field, so that they are rejected as a missing proof.
+func (pow *Middleware) jsonValue(r *http.Request, path string) (string, error) {
+	body, err := readBody(r, pow.MaxBodySize)
+	if err != nil || len(body) == 0 {
+		return "", err
+	}
+
+	v, err := decodeJSON(body)
+	if err != nil {
+		return "", err
+	}
+
+	if path != "" {
+		var ok bool
+		if v, ok = lookupField(v, path); !ok {
+			return "", nil
+		}
+	}
+
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+
+	var buf bytes.Buffer
+	err = writeCanonical(&buf, v)
+	return buf.String(), err
+}
+
+// sources parses the source specs of the nonce, nonce checksum, hash and data. The data
+// source is nil if `DataSource` is not set.
+func (pow *Middleware) sources() (nonce, nonceChecksum, hash, data sourceFunc, err error) {
+	specs := []struct {
+		field string
+		spec  string
+		fn    *sourceFunc
+	}{
+		{"NonceSource", pow.NonceSource, &nonce},
+		{"NonceChecksumSource", pow.NonceChecksumSource, &nonceChecksum},
+		{"HashSource", pow.HashSource, &hash},
+		{"DataSource", pow.DataSource, &data},
+	}
+
+	for _, s := range specs {
+		if s.spec == "" {
+			continue
+		}
+
+		if *s.fn, err = pow.parseSource(s.spec); err != nil {
+			return nil, nil, nil, nil, fmt.Errorf("pow.%v: %v", s.field, err)
+		}
+	}
+	return nonce, nonceChecksum, hash, data, nil
+}
@@ -0,0 +1,155 @@
+package ginpow
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMiddleware_parseSource(t *testing.T) {
+	m, _ := New(&Middleware{})
+
+	newRequest := func(contentType, body string) *http.Request {
+		req := httptest.NewRequest("POST", "/?n=query", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("X-Proof", "header")
+		req.AddCookie(&http.Cookie{Name: "pow", Value: "cookie"})
+		return req
+	}
+
+	tests := []struct {
+		spec   string
+		req    *http.Request
+		expect string
+	}{
+		{"header:X-Proof", newRequest("", ""), "header"},
+		{"query:n", newRequest("", ""), "query"},
+		{"cookie:pow", newRequest("", ""), "cookie"},
+		{"cookie:missing", newRequest("", ""), ""},
+		{"form:nonce", newRequest("application/x-www-form-urlencoded", "nonce=form&n=other"), "form"},
+		{"json:$.proof.hash", newRequest("application/json", `{"proof": {"hash": "json"}}`), "json"},
+		{"json:proof.hash", newRequest("application/json", `{"proof": {"hash": "json"}}`), "json"},
+		{"json:$.items[1]", newRequest("application/json", `{"items": [1, 2.0]}`), "2"},
+		{"json:$.proof", newRequest("application/json", `{"proof": {"b": 1, "a": 2}}`), `{"a":2,"b":1}`},
+		{"json:$.missing", newRequest("application/json", `{}`), ""},
+		{"json:$.missing", newRequest("application/json", ``), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			source, err := m.parseSource(tt.spec)
+			if err != nil {
+				t.Fatalf("parseSource() returned error: %v", err)
+			}
+
+			body, _ := ioutil.ReadAll(tt.req.Body)
+			tt.req.Body = ioutil.NopCloser(strings.NewReader(string(body)))
+
+			got, err := source(tt.req)
+			if err != nil || got != tt.expect {
+				t.Errorf("source; Got: %q %v, Expected: %q", got, err, tt.expect)
+			}
+
+			if b, _ := ioutil.ReadAll(tt.req.Body); string(b) != string(body) {
+				t.Errorf("body not restored; Got: %q, Expected: %q", b, body)
+			}
+		})
+	}
+
+	t.Run("invalid JSON", func(t *testing.T) {
+		source, _ := m.parseSource("json:hash")
+
+		if _, err := source(newRequest("application/json", "{")); !errors.Is(err, ErrInvalidJSON) {
+			t.Errorf("source; Got: %v, Expected: %v", err, ErrInvalidJSON)
+		}
+	})
+
+	for _, spec := range []string{"X-Nonce", "header:", "body:nonce"} {
+		t.Run("invalid "+spec, func(t *testing.T) {
+			if _, err := m.parseSource(spec); err == nil {
+				t.Errorf("parseSource(%q) did not error", spec)
+			}
+		})
+	}
+}
+
+func TestMiddleware_sources(t *testing.T) {
+	t.Run("configured headers", func(t *testing.T) {
+		m, _ := New(&Middleware{NonceHeader: "N", NonceChecksumHeader: "N-Checksum"})
+
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/", nil)
+		c.Request.Header.Set("N", "nonce")
+		c.Request.Header.Set("N-Checksum", "checksum")
+
+		if nonce, checksum, _ := m.ExtractNonce(c); nonce != "nonce" || checksum != "checksum" {
+			t.Errorf("ExtractNonce() ignored the configured headers; Got: %v %v", nonce, checksum)
+		}
+	})
+
+	t.Run("invalid source", func(t *testing.T) {
+		if _, err := New(&Middleware{HashSource: "body:hash"}); err == nil {
+			t.Error("New() did not error for an invalid HashSource")
+		}
+
+		if _, err := NewHTTP(&HTTPMiddleware{Middleware: &Middleware{DataSource: "data"}}); err == nil {
+			t.Error("NewHTTP() did not error for an invalid DataSource")
+		}
+	})
+
+	t.Run("verify", func(t *testing.T) {
+		m, _ := New(&Middleware{
+			Difficulty:  4,
+			NonceSource: "query:nonce",
+			HashSource:  "json:$.proof.hash",
+			DataSource:  "json:$.proof.data",
+		})
+
+		data, hash := solve("data", "nonce", 4)
+
+		r := gin.New()
+		r.POST("/", m.VerifyNonceMiddleware, func(c *gin.Context) {
+			b, _ := ioutil.ReadAll(c.Request.Body)
+			c.Data(200, "application/json", b)
+		})
+
+		body := `{"proof": {"hash": "` + hash + `", "data": "` + data + `"}}`
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", "/?nonce=nonce", strings.NewReader(body)))
+
+		if w.Code != 200 || w.Body.String() != body {
+			t.Errorf("unexpected response; Got: %v %q", w.Code, w.Body.String())
+		}
+
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", "/", strings.NewReader(body)))
+
+		if w.Code != 400 {
+			t.Errorf("missing nonce; Got: %v, Expected: 400", w.Code)
+		}
+	})
+}
+
+func TestHTTPMiddleware_sources(t *testing.T) {
+	m, _ := NewHTTP(&HTTPMiddleware{
+		Middleware: &Middleware{NonceSource: "cookie:nonce", HashSource: "form:hash", DataSource: "header:X-Data"},
+	})
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader("hash=abc"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Data", "data")
+	req.AddCookie(&http.Cookie{Name: "nonce", Value: "nonce"})
+
+	nonce, _, _ := m.ExtractNonce(req)
+	hash, _ := m.ExtractHash(req)
+	data, _ := m.ExtractData(req)
+
+	if nonce != "nonce" || hash != "abc" || data != "data" {
+		t.Errorf("unexpected extraction; Got: %v %v %v", nonce, hash, data)
+	}
+}